@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -19,17 +20,27 @@ var version = "0.0.0"
 
 type config struct {
 	scraper.Handler
-	ConfigFile string `opts:"mode=arg" help:"Path to JSON <config-file>"`
-	Host       string `help:"Listening interface"`
-	Port       int    `help:"Listening port"`
-	NoLog      bool   `help:"Disable access logs"`
+	ConfigFile     string        `opts:"mode=arg" help:"Path to JSON <config-file>"`
+	UsersFile      string        `opts:"short=u" help:"Path to a JSON file of users (also read from $SCRAPER_USERS)"`
+	Host           string        `opts:"short=h" help:"Listening interface"`
+	Port           int           `opts:"short=p" help:"Listening port"`
+	NoLog          bool          `help:"Disable access logs"`
+	DiskCache      string        `help:"Directory to cache raw upstream responses in (disabled by default)"`
+	DiskCacheTTL   time.Duration `help:"How long responses are kept in the disk cache (0 keeps them until evicted)"`
+	DiskCacheBytes int64         `help:"Maximum size of the disk cache in bytes (0 is unbounded)"`
 }
 
 func main() {
 	c := config{
-		Handler: scraper.Handler{Log: true},
-		Host:    "0.0.0.0",
-		Port:    3000,
+		Handler: scraper.Handler{
+			Log:          true,
+			Timeout:      30 * time.Second,
+			Attempts:     1,
+			CacheEntries: 1000,
+			CacheBytes:   64 << 20,
+		},
+		Host: "0.0.0.0",
+		Port: 3000,
 	}
 	h := &c.Handler
 
@@ -39,9 +50,21 @@ func main() {
 		Parse()
 
 	h.Log = !c.NoLog
+	if c.DiskCache != "" {
+		h.Scraper = &scraper.Scraper{
+			Cache: &scraper.DiskCache{
+				Dir:      c.DiskCache,
+				TTL:      c.DiskCacheTTL,
+				MaxBytes: c.DiskCacheBytes,
+			},
+		}
+	}
 	if err := h.LoadConfigFile(c.ConfigFile); err != nil {
 		log.Fatal(err)
 	}
+	if err := loadUsers(h, c.UsersFile); err != nil {
+		log.Fatal(err)
+	}
 
 	hup := make(chan os.Signal, 1)
 	signal.Notify(hup, syscall.SIGHUP)
@@ -49,6 +72,8 @@ func main() {
 		for range hup {
 			if err := h.LoadConfigFile(c.ConfigFile); err != nil {
 				log.Printf("[scraper] Failed to load configuration: %s", err)
+			} else if err := loadUsers(h, c.UsersFile); err != nil {
+				log.Printf("[scraper] Failed to load users: %s", err)
 			} else {
 				log.Printf("[scraper] Successfully loaded new configuration")
 			}
@@ -81,3 +106,33 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadUsers sets the handler's users from the users
+// file and the SCRAPER_USERS environment variable
+func loadUsers(h *scraper.Handler, path string) error {
+	users := []scraper.User{}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		us, err := scraper.ParseUsers(b)
+		if err != nil {
+			return err
+		}
+		users = append(users, us...)
+	}
+	if env := os.Getenv("SCRAPER_USERS"); env != "" {
+		us, err := scraper.ParseUsers([]byte(env))
+		if err != nil {
+			return fmt.Errorf("SCRAPER_USERS: %w", err)
+		}
+		users = append(users, us...)
+	}
+	// a name may not be reused across the two sources
+	if err := scraper.ValidateUsers(users); err != nil {
+		return err
+	}
+	h.SetUsers(users)
+	return nil
+}
@@ -0,0 +1,156 @@
+package scraper
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// user roles
+const (
+	// RoleAdmin may use every endpoint, and the admin actions on the root path
+	RoleAdmin = "admin"
+	// RoleReader may use the endpoints matching its Endpoints
+	RoleReader = "reader"
+)
+
+// User is a credential accepted by the Handler. Users authenticate
+// with basic auth (Name and Password), or with their Token given as
+// an "Authorization: Bearer <token>" or "X-API-Key: <token>" header.
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Role     string `json:"role"`
+	// Endpoints are the endpoint paths or globs (see path.Match)
+	// a reader may use. Readers must have at least one.
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+func (u *User) validate() error {
+	if u.Name == "" {
+		return errors.New("user: missing name")
+	}
+	if u.Password == "" && u.Token == "" {
+		return fmt.Errorf("user %s: expected a password or a token", u.Name)
+	}
+	switch u.Role {
+	case RoleAdmin:
+		if len(u.Endpoints) > 0 {
+			return fmt.Errorf("user %s: admins may use every endpoint", u.Name)
+		}
+	case RoleReader:
+		if len(u.Endpoints) == 0 {
+			return fmt.Errorf("user %s: readers must have endpoints", u.Name)
+		}
+		for _, e := range u.Endpoints {
+			if _, err := path.Match(strings.TrimPrefix(e, "/"), ""); err != nil {
+				return fmt.Errorf("user %s: invalid endpoint %q", u.Name, e)
+			}
+		}
+	default:
+		return fmt.Errorf("user %s: unknown role %q (expected %q or %q)", u.Name, u.Role, RoleAdmin, RoleReader)
+	}
+	return nil
+}
+
+// admin reports whether the user may use the admin actions.
+// A nil user means authentication is disabled.
+func (u *User) admin() bool {
+	return u == nil || u.Role == RoleAdmin
+}
+
+// allowed reports whether the user may use the endpoint
+// with the given route path, requested at the given path.
+// A nil user means authentication is disabled, while
+// a reader without endpoints may use none.
+func (u *User) allowed(route, requested string) bool {
+	if u.admin() {
+		return true
+	}
+	for _, e := range u.Endpoints {
+		e = strings.TrimPrefix(e, "/")
+		for _, p := range []string{route, requested} {
+			if ok, _ := path.Match(e, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseUsers parses and validates a JSON array of users
+func ParseUsers(b []byte) ([]User, error) {
+	users := []User{}
+	if err := json.Unmarshal(b, &users); err != nil {
+		return nil, fmt.Errorf("users: %w", err)
+	}
+	if err := ValidateUsers(users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ValidateUsers validates each of the users, and
+// checks that no two of them share a name
+func ValidateUsers(users []User) error {
+	names := map[string]bool{}
+	for i := range users {
+		u := &users[i]
+		if err := u.validate(); err != nil {
+			return err
+		}
+		if names[u.Name] {
+			return fmt.Errorf("user %s: duplicate name", u.Name)
+		}
+		names[u.Name] = true
+	}
+	return nil
+}
+
+// SetUsers replaces the handler's users, and
+// may be called while it is serving requests
+func (h *Handler) SetUsers(users []User) {
+	h.mu.Lock()
+	h.Users = users
+	h.mu.Unlock()
+}
+
+// authenticate returns the user making the request, or ok=false if
+// the request has no valid credentials. When neither Auth nor Users
+// are set, authentication is disabled and the user is nil.
+func (h *Handler) authenticate(r *http.Request) (user *User, ok bool) {
+	h.mu.RLock()
+	users := h.Users
+	h.mu.RUnlock()
+	if h.Auth == "" && len(users) == 0 {
+		return nil, true
+	}
+	token := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	name, pass, basic := r.BasicAuth()
+	if basic && h.Auth != "" && equal(name+":"+pass, h.Auth) {
+		return &User{Name: name, Role: RoleAdmin}, true
+	}
+	for i := range users {
+		u := &users[i]
+		if token != "" && u.Token != "" && equal(token, u.Token) {
+			return u, true
+		}
+		if basic && u.Password != "" && name == u.Name && equal(pass, u.Password) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// equal compares secrets in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
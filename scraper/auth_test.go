@@ -0,0 +1,123 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseUsers(t *testing.T) {
+	users, err := ParseUsers([]byte(`[
+		{"name": "ops", "password": "p", "role": "admin"},
+		{"name": "app", "token": "t", "role": "reader", "endpoints": ["/a", "b/*"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[1].Endpoints[1] != "b/*" {
+		t.Fatalf("got %+v", users)
+	}
+	for input, want := range map[string]string{
+		`[{"password": "p", "role": "admin"}]`:                                                                              "missing name",
+		`[{"name": "a", "role": "admin"}]`:                                                                                  "password or a token",
+		`[{"name": "a", "token": "t", "role": "root"}]`:                                                                     "unknown role",
+		`[{"name": "a", "token": "t", "role": "admin", "endpoints": ["/a"]}]`:                                               "every endpoint",
+		`[{"name": "a", "token": "t", "role": "reader", "endpoints": ["[a"]}]`:                                              "invalid endpoint",
+		`[{"name": "a", "token": "t", "role": "reader"}]`:                                                                   "must have endpoints",
+		`[{"name": "a", "token": "t", "role": "reader", "endpoints": ["a"]}, {"name": "a", "token": "u", "role": "admin"}]`: "duplicate name",
+		`{}`: "users:",
+	} {
+		if _, err := ParseUsers([]byte(input)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want error containing %q, got %v", input, want, err)
+		}
+	}
+	// users merged from two sources
+	a, _ := ParseUsers([]byte(`[{"name": "a", "token": "t", "role": "admin"}]`))
+	b, _ := ParseUsers([]byte(`[{"name": "a", "token": "u", "role": "admin"}]`))
+	if err := ValidateUsers(append(a, b...)); err == nil || !strings.Contains(err.Error(), "duplicate name") {
+		t.Errorf("merged: want duplicate name error, got %v", err)
+	}
+}
+
+func TestHandlerUsers(t *testing.T) {
+	rt := &recorder{body: `<h1>ok</h1>`}
+	users, err := ParseUsers([]byte(`[
+		{"name": "ops", "password": "secret", "role": "admin"},
+		{"name": "app", "token": "apptoken", "role": "reader", "endpoints": ["/public/*", "user/:id"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{Scraper: &Scraper{Transport: rt}, Users: users, Auth: "root:pw"}
+	err = h.LoadConfig([]byte(`{
+		"/public/a": {"url": "https://example.invalid/", "result": {"x": "h1"}},
+		"/user/:id": {"url": "https://example.invalid/{{id}}", "result": {"x": "h1"}},
+		"/private": {"url": "https://example.invalid/", "result": {"x": "h1"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic := func(user, pass string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, pass) }
+	}
+	header := func(k, v string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set(k, v) }
+	}
+	tests := []struct {
+		method, path string
+		auth         func(*http.Request)
+		want         int
+	}{
+		{"GET", "/public/a", nil, http.StatusUnauthorized},
+		{"GET", "/public/a", basic("ops", "wrong"), http.StatusUnauthorized},
+		{"GET", "/public/a", header("Authorization", "Bearer nope"), http.StatusUnauthorized},
+		{"GET", "/public/a", basic("ops", "secret"), http.StatusOK},
+		{"GET", "/private", basic("ops", "secret"), http.StatusOK},
+		{"GET", "/", basic("ops", "secret"), http.StatusOK},
+		{"GET", "/", basic("root", "pw"), http.StatusOK},
+		{"GET", "/public/a", header("Authorization", "Bearer apptoken"), http.StatusOK},
+		{"GET", "/user/7", header("X-API-Key", "apptoken"), http.StatusOK},
+		{"GET", "/private", header("X-API-Key", "apptoken"), http.StatusForbidden},
+		{"GET", "/", header("X-API-Key", "apptoken"), http.StatusForbidden},
+		{"POST", "/", header("X-API-Key", "apptoken"), http.StatusForbidden},
+		{"GET", "/public/a", basic("app", "apptoken"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+		if tt.auth != nil {
+			tt.auth(r)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s (%v): expected %d, got %d: %s", tt.method, tt.path, r.Header, tt.want, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestHandlerNoAuth(t *testing.T) {
+	h := &Handler{}
+	if err := h.LoadConfig([]byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected open admin without auth, got %d", rec.Code)
+	}
+}
+
+func TestUserAllowed(t *testing.T) {
+	u := &User{Name: "app", Role: RoleReader, Endpoints: []string{"/user/*"}}
+	if !u.allowed("user/:id", "user/7") || u.allowed("admin", "admin") {
+		t.Fatal("expected only matching endpoints to be allowed")
+	}
+	u.Endpoints = nil
+	if u.allowed("user/:id", "user/7") {
+		t.Fatal("expected a reader without endpoints to be denied")
+	}
+	if !(*User)(nil).allowed("user/:id", "user/7") {
+		t.Fatal("expected every endpoint to be allowed without authentication")
+	}
+}
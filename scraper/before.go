@@ -0,0 +1,285 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/xmlquery"
+)
+
+// errLoggedOut is returned by executePage when
+// the response matches the endpoint's LoggedOut rules
+var errLoggedOut = errors.New("logged out")
+
+// Step is a request made before an endpoint's own request, for
+// example to log in or to fetch a CSRF token. Its results become
+// template variables of the following steps and of the endpoint.
+type Step struct {
+	// Mode defaults to the endpoint's mode
+	Mode    string            `json:"mode,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Result  map[string]Field  `json:"result,omitempty"`
+}
+
+// LoggedOut detects responses which require the before
+// steps to be run again
+type LoggedOut struct {
+	// Status are the statuses of a logged out response (defaults to 401)
+	Status StatusRules `json:"status,omitempty"`
+	// Selector matches a logged out response, for example a login form.
+	// It is a CSS selector in HTML mode, an XPath selector in XML mode,
+	// and a jq selector in JSON mode which matches when it returns any
+	// value other than null or false.
+	Selector string `json:"selector,omitempty"`
+}
+
+// status reports whether the status is logged out, nil-safe
+func (l *LoggedOut) status(code int) bool {
+	if l == nil || len(l.Status) == 0 {
+		return code == http.StatusUnauthorized
+	}
+	return l.Status.match(code)
+}
+
+// login is the result of an endpoint's before steps in a session
+type login struct {
+	vars map[string]string
+	gen  int
+}
+
+// validateBefore checks that the before steps only use the variables
+// extracted by earlier steps. The steps log in the session once for
+// every caller, so they must not depend on the request's params.
+func (e *Endpoint) validateBefore() error {
+	vars := map[string]bool{}
+	for i, s := range e.Before {
+		templates := []string{s.URL, s.Body}
+		for _, v := range s.Headers {
+			templates = append(templates, v)
+		}
+		for _, t := range templates {
+			for _, m := range templateRe.FindAllStringSubmatch(t, -1) {
+				if !vars[m[1]] {
+					return fmt.Errorf("before step %d: unknown variable %q (steps may only use the results of earlier steps)", i+1, m[1])
+				}
+			}
+		}
+		for name := range s.Result {
+			vars[name] = true
+		}
+	}
+	return nil
+}
+
+// login returns the variables extracted by the endpoint's before
+// steps, running them when they have not run in this session yet, or
+// when the variables of generation stale were found to be logged out.
+func (sess *session) login(ctx context.Context, e *Endpoint, stale int) (*login, error) {
+	sess.loginMu.Lock()
+	defer sess.loginMu.Unlock()
+	l := e.login
+	if l != nil && l.gen != stale {
+		return l, nil
+	}
+	vars, err := e.runBefore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gen := 1
+	if l != nil {
+		gen = l.gen + 1
+	}
+	e.login = &login{vars: vars, gen: gen}
+	return e.login, nil
+}
+
+// runBefore runs the before steps in order, returning their results
+func (e *Endpoint) runBefore(ctx context.Context) (map[string]string, error) {
+	vars := map[string]string{}
+	for i, s := range e.Before {
+		if e.Debug {
+			logf("before step %d/%d", i+1, len(e.Before))
+		}
+		// endpoint headers using template variables may
+		// need the results of this step, so are left out
+		base := map[string]string{}
+		for k, v := range e.Headers {
+			if !templateRe.MatchString(v) {
+				base[k] = v
+			}
+		}
+		headers, err := templateHeaders(base, s.Headers, vars)
+		if err != nil {
+			return nil, fmt.Errorf("before step %d: %w", i+1, err)
+		}
+		mode := s.Mode
+		if mode == "" {
+			mode = e.Mode
+		}
+		if len(s.Result) == 0 {
+			// nothing to extract, any response will do
+			mode = "html"
+		}
+		step := &Endpoint{
+			Mode:       mode,
+			Method:     s.Method,
+			URL:        s.URL,
+			Body:       s.Body,
+			Headers:    headers,
+			Timeout:    e.Timeout,
+			Retry:      e.Retry,
+			Limit:      e.Limit,
+			Proxy:      e.Proxy,
+			Browser:    e.Browser,
+			Session:    e.Session,
+			Result:     s.Result,
+			Namespaces: e.Namespaces,
+			xpaths:     e.xpaths,
+			CSV:        e.CSV,
+			Table:      e.Table,
+			Debug:      e.Debug,
+			Scraper:    e.Scraper,
+		}
+		results, _, err := step.executePage(ctx, vars, "")
+		if err != nil {
+			return nil, fmt.Errorf("before step %d: %w", i+1, err)
+		}
+		for name := range s.Result {
+			var v any
+			if len(results) > 0 {
+				v = results[0][name]
+			}
+			str := jsonValueString(v)
+			if str == "" {
+				return nil, fmt.Errorf("before step %d: missing %s", i+1, name)
+			}
+			vars[name] = str
+		}
+	}
+	return vars, nil
+}
+
+// executeLogin executes the endpoint after its before steps, running
+// them again once if the endpoint's response is logged out
+func (e *Endpoint) executeLogin(ctx context.Context, params map[string]string) ([]Result, error) {
+	if err := e.validateBefore(); err != nil {
+		return nil, err
+	}
+	sess, err := e.scraper().session(e)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, errors.New("before steps require a session")
+	}
+	stale := 0
+	for {
+		l, err := sess.login(ctx, e, stale)
+		if err != nil {
+			return nil, err
+		}
+		vars := map[string]string{}
+		for k, v := range params {
+			vars[k] = v
+		}
+		for k, v := range l.vars {
+			vars[k] = v
+		}
+		run := e
+		if len(e.Headers) > 0 {
+			headers, err := templateHeaders(e.Headers, nil, vars)
+			if err != nil {
+				return nil, err
+			}
+			c := *e
+			c.Headers = headers
+			run = &c
+		}
+		results, err := run.execute(ctx, vars)
+		if !errors.Is(err, errLoggedOut) {
+			return results, err
+		}
+		if stale != 0 {
+			return nil, errors.New("still logged out after running the before steps")
+		}
+		if e.Debug {
+			logf("logged out, running the before steps again")
+		}
+		stale = l.gen
+	}
+}
+
+// templateHeaders merges the extra headers over the base
+// headers, replacing the template variables of both
+func templateHeaders(base, extra map[string]string, vars map[string]string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, hs := range []map[string]string{base, extra} {
+		for k, v := range hs {
+			v, err := template(false, v, vars)
+			if err != nil {
+				return nil, err
+			}
+			headers[k] = v
+		}
+	}
+	return headers, nil
+}
+
+// loggedOut checks the response against the endpoint's LoggedOut
+// rules. The body is buffered, and replaced so it can be read again.
+func (e *Endpoint) loggedOut(resp *response) (bool, error) {
+	if resp.StatusCode != 0 && e.LoggedOut.status(resp.StatusCode) {
+		return true, nil
+	}
+	if e.LoggedOut == nil || e.LoggedOut.Selector == "" {
+		return false, nil
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	sel := e.LoggedOut.Selector
+	if e.mode() == "xml" {
+		doc, err := xmlquery.Parse(bytes.NewReader(b))
+		if err != nil {
+			return false, nil
+		}
+		nodes, err := e.xpathNodes(doc, sel)
+		if err != nil {
+			return false, fmt.Errorf("logged out selector %q: %w", sel, err)
+		}
+		return len(nodes) > 0, nil
+	}
+	if e.mode() == "json" {
+		var data any
+		if err := json.Unmarshal(b, &data); err != nil {
+			return false, nil
+		}
+		items, err := runJQ(data, sel)
+		if err != nil {
+			return false, fmt.Errorf("logged out selector %q: %w", sel, err)
+		}
+		for _, v := range items {
+			if v != nil && v != false {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(b))
+	if err != nil {
+		return false, nil
+	}
+	return doc.Find(sel).Length() > 0, nil
+}
@@ -0,0 +1,167 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// loginServer serves a login form with a CSRF token, and /data to
+// logged in clients. Other clients are answered with 401, or with the
+// login form when form is set. Each login creates a new session id.
+type loginServer struct {
+	mu     sync.Mutex
+	form   bool
+	sid    string
+	logins int
+}
+
+func (s *loginServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	const loginForm = `<form id="login"><input type="hidden" name="csrf" value="tok"></form>`
+	switch r.URL.Path {
+	case "/login":
+		if r.Method == http.MethodGet {
+			w.Write([]byte(loginForm))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("csrf") != "tok" || r.PostForm.Get("user") != "bob" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.logins++
+		s.sid = strconv.Itoa(s.logins)
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: s.sid, Path: "/"})
+		w.Write([]byte(`<p id="welcome">bob</p>`))
+	case "/data":
+		if c, err := r.Cookie("sid"); err != nil || c.Value != s.sid || r.Header.Get("X-CSRF") != "tok" {
+			if s.form {
+				w.Write([]byte(loginForm))
+			} else {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			return
+		}
+		w.Write([]byte(`<h1>secret ` + s.sid + `</h1>`))
+	}
+}
+
+// expire logs out every client
+func (s *loginServer) expire() {
+	s.mu.Lock()
+	s.sid = "expired"
+	s.mu.Unlock()
+}
+
+func loginEndpoint(t *testing.T, url string) *Endpoint {
+	return &Endpoint{
+		URL:     url + "/data",
+		Headers: map[string]string{"X-CSRF": "{{csrf}}"},
+		Before: []Step{
+			{
+				URL:    url + "/login",
+				Result: map[string]Field{"csrf": {Extract: mustExtractors(t, "input[name=csrf]", "@value")}},
+			},
+			{
+				Method: http.MethodPost,
+				URL:    url + "/login",
+				Body:   "user=bob&csrf={{csrf}}",
+				Headers: map[string]string{
+					"Content-Type": "application/x-www-form-urlencoded",
+				},
+			},
+		},
+		Session: &Session{},
+		Result:  map[string]Field{"data": {Extract: mustExtractors(t, "h1")}},
+	}
+}
+
+func TestBefore(t *testing.T) {
+	for _, form := range []bool{false, true} {
+		s := &loginServer{form: form}
+		ts := httptest.NewServer(s)
+		e := loginEndpoint(t, ts.URL)
+		if form {
+			e.LoggedOut = &LoggedOut{Selector: "form#login"}
+		}
+		for i, want := range []string{"secret 1", "secret 1"} {
+			res, err := e.Execute(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res[0]["data"] != want {
+				t.Fatalf("request %d: expected %q, got %v", i, want, res)
+			}
+		}
+		// logged out: the steps run again
+		s.expire()
+		res, err := e.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res[0]["data"] != "secret 2" {
+			t.Fatalf("expected a new login, got %v", res)
+		}
+		if s.logins != 2 {
+			t.Fatalf("expected 2 logins, got %d", s.logins)
+		}
+		ts.Close()
+	}
+}
+
+func TestBeforeFailure(t *testing.T) {
+	s := &loginServer{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	e := loginEndpoint(t, ts.URL)
+	// rejected login
+	e.Before[1].Body = "user=eve&csrf={{csrf}}"
+	if _, err := e.Execute(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	// missing extracted value
+	e = loginEndpoint(t, ts.URL)
+	e.Before[0].Result["csrf"] = Field{Extract: mustExtractors(t, "input[name=missing]", "@value")}
+	if _, err := e.Execute(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	// no session
+	e = loginEndpoint(t, ts.URL)
+	e.Session = nil
+	if _, err := e.Execute(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestBeforeParams(t *testing.T) {
+	s := &loginServer{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	// the steps log in once for every caller, so two callers
+	// sending different credentials must not share a login
+	e := loginEndpoint(t, ts.URL)
+	e.Before[1].Body = "user={{user}}&csrf={{csrf}}"
+	for _, user := range []string{"bob", "eve"} {
+		if _, err := e.Execute(map[string]string{"user": user}); err == nil || !strings.Contains(err.Error(), `unknown variable "user"`) {
+			t.Fatalf("%s: expected an unknown variable error, got %v", user, err)
+		}
+	}
+	if s.logins != 0 {
+		t.Fatalf("expected no logins, got %d", s.logins)
+	}
+	// and such a config is rejected when loaded
+	h := &Handler{}
+	err := h.LoadConfig([]byte(`{"/data": {
+		"url": "` + ts.URL + `/data?user={{user}}",
+		"before": [{"method": "POST", "url": "` + ts.URL + `/login", "body": "user={{user}}"}],
+		"result": {"data": "h1"}
+	}}`))
+	if err == nil || !strings.Contains(err.Error(), "before step 1") {
+		t.Fatalf("expected a before step error, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/enetx/g"
+	"github.com/enetx/surf"
+)
+
+// Browser selects how the endpoint's requests look to the upstream
+// server: the impersonated browser (TLS and HTTP/2 fingerprints,
+// and default headers), its OS, the HTTP version and user agent.
+// Endpoints with different browsers use separate clients.
+type Browser struct {
+	// Impersonate is "chrome", "firefox" or "none" (the default)
+	Impersonate string `json:"impersonate,omitempty"`
+	// OS is the impersonated browser's OS: "windows" (the
+	// default), "macos", "linux", "android", "ios" or "random"
+	OS string `json:"os,omitempty"`
+	// HTTP forces the HTTP version, "1.1" or "2"
+	HTTP string `json:"http,omitempty"`
+	// UserAgents are picked at random for each request, unless
+	// the endpoint sets a User-Agent header
+	UserAgents []string `json:"userAgents,omitempty"`
+}
+
+func (b *Browser) UnmarshalJSON(data []byte) error {
+	type browser Browser
+	if err := json.Unmarshal(data, (*browser)(b)); err != nil {
+		return fmt.Errorf("browser: %w", err)
+	}
+	return b.validate()
+}
+
+func (b *Browser) validate() error {
+	switch b.Impersonate {
+	case "", "none", "chrome", "firefox":
+	default:
+		return fmt.Errorf("browser: unknown impersonate %q (expected chrome, firefox or none)", b.Impersonate)
+	}
+	switch b.OS {
+	case "", "windows", "macos", "linux", "android", "ios", "random":
+	default:
+		return fmt.Errorf("browser: unknown os %q (expected windows, macos, linux, android, ios or random)", b.OS)
+	}
+	switch b.HTTP {
+	case "", "1.1", "2":
+	default:
+		return fmt.Errorf("browser: unknown http version %q (expected 1.1 or 2)", b.HTTP)
+	}
+	return nil
+}
+
+// impersonates reports whether the browser impersonates one
+func (b *Browser) impersonates() bool {
+	return b.Impersonate != "" && b.Impersonate != "none"
+}
+
+// profile identifies the client built for the browser, nil-safe.
+// User agents are set per request, so are not part of it.
+func (b *Browser) profile() string {
+	if b == nil {
+		return ""
+	}
+	impersonate := b.Impersonate
+	if impersonate == "none" {
+		impersonate = ""
+	}
+	if impersonate == "" && b.HTTP == "" {
+		return ""
+	}
+	return strings.Join([]string{impersonate, b.OS, b.HTTP}, "/")
+}
+
+// userAgent picks the user agent of a request, nil-safe
+func (b *Browser) userAgent(headers map[string]string) (map[string]string, string) {
+	if b == nil || len(b.UserAgents) == 0 {
+		return headers, ""
+	}
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == "User-Agent" {
+			return headers, ""
+		}
+	}
+	ua := b.UserAgents[rand.IntN(len(b.UserAgents))]
+	hs := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		hs[k] = v
+	}
+	hs["User-Agent"] = ua
+	return hs, ua
+}
+
+// newSurfClient builds a surf client for the browser profile,
+// routed through the proxy when set
+func newSurfClient(b *Browser, proxy string) (*surf.Client, error) {
+	builder := surf.NewClient().Builder()
+	if b != nil {
+		switch b.Impersonate {
+		case "chrome", "firefox":
+			im := builder.Impersonate()
+			switch b.OS {
+			case "macos":
+				im = im.MacOS()
+			case "linux":
+				im = im.Linux()
+			case "android":
+				im = im.Android()
+			case "ios":
+				im = im.IOS()
+			case "random":
+				im = im.RandomOS()
+			default:
+				im = im.Windows()
+			}
+			if b.Impersonate == "chrome" {
+				builder = im.Chrome()
+			} else {
+				builder = im.Firefox()
+			}
+		}
+		switch b.HTTP {
+		case "1.1":
+			builder = builder.ForceHTTP1()
+		case "2":
+			builder = builder.ForceHTTP2()
+		}
+	}
+	if proxy != "" {
+		builder = builder.Proxy(g.String(proxy))
+	}
+	r := builder.Build()
+	if r.IsErr() {
+		if proxy != "" {
+			return nil, fmt.Errorf("proxy %s: %w", redact(proxy), r.Err())
+		}
+		return nil, r.Err()
+	}
+	return r.Ok(), nil
+}
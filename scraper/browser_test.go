@@ -0,0 +1,129 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// userAgentServer echoes the request's user agent
+func userAgentServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<h1>` + r.UserAgent() + `</h1>`))
+	}))
+}
+
+func TestBrowser(t *testing.T) {
+	ts := userAgentServer()
+	defer ts.Close()
+	for _, b := range []*Browser{
+		{Impersonate: "chrome", OS: "macos"},
+		{Impersonate: "firefox", HTTP: "1.1"},
+		{UserAgents: []string{"bot/1"}},
+	} {
+		e := &Endpoint{
+			URL:     ts.URL,
+			Browser: b,
+			Result:  map[string]Field{"ua": {Extract: mustExtractors(t, "h1")}},
+			Scraper: &Scraper{},
+		}
+		res, err := e.Execute(nil)
+		if err != nil {
+			t.Fatalf("%+v: %s", b, err)
+		}
+		ua, _ := res[0]["ua"].(string)
+		if b.Impersonate == "chrome" && !strings.Contains(ua, "Chrome") ||
+			b.Impersonate == "firefox" && !strings.Contains(ua, "Firefox") ||
+			len(b.UserAgents) > 0 && ua != "bot/1" {
+			t.Fatalf("%+v: unexpected user agent %q", b, ua)
+		}
+	}
+}
+
+func TestBrowserUserAgents(t *testing.T) {
+	ts := userAgentServer()
+	defer ts.Close()
+	e := &Endpoint{
+		URL:     ts.URL,
+		Browser: &Browser{UserAgents: []string{"a", "b"}},
+		Result:  map[string]Field{"ua": {Extract: mustExtractors(t, "h1")}},
+		Scraper: &Scraper{Transport: http.DefaultTransport},
+	}
+	seen := map[any]bool{}
+	for range 50 {
+		res, err := e.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[res[0]["ua"]] = true
+	}
+	if len(seen) != 2 || !seen["a"] || !seen["b"] {
+		t.Fatalf("expected both user agents, got %v", seen)
+	}
+	// the endpoint's header wins
+	e.Headers = map[string]string{"user-agent": "c"}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0]["ua"] != "c" {
+		t.Fatalf("expected header user agent, got %v", res)
+	}
+}
+
+func TestBrowserClients(t *testing.T) {
+	s := &Scraper{}
+	chrome := &Browser{Impersonate: "chrome"}
+	c1, err := s.surfClient(nil, chrome, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _ := s.surfClient(nil, &Browser{Impersonate: "chrome"}, "")
+	c3, _ := s.surfClient(nil, &Browser{Impersonate: "firefox"}, "")
+	c4, _ := s.surfClient(nil, &Browser{UserAgents: []string{"a"}}, "")
+	if c1 != c2 {
+		t.Fatal("expected the same profile to reuse its client")
+	}
+	if c1 == c3 {
+		t.Fatal("expected separate clients for separate profiles")
+	}
+	if c4 != s.client() {
+		t.Fatal("expected user agents alone to use the default client")
+	}
+}
+
+func TestBrowserJSON(t *testing.T) {
+	var b Browser
+	if err := json.Unmarshal([]byte(`{"impersonate": "chrome", "os": "ios", "http": "2"}`), &b); err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{`{"impersonate": "safari"}`, `{"os": "beos"}`, `{"http": "3"}`} {
+		if err := json.Unmarshal([]byte(input), &b); err == nil {
+			t.Fatalf("%s: expected an error", input)
+		}
+	}
+}
+
+func TestHandlerBrowserOS(t *testing.T) {
+	for _, c := range []struct {
+		h       *Handler
+		browser string
+		ok      bool
+	}{
+		{&Handler{}, `{"os": "macos"}`, false},
+		{&Handler{}, `{"impersonate": "none", "os": "macos"}`, false},
+		{&Handler{}, `{"impersonate": "chrome", "os": "macos"}`, true},
+		{&Handler{Impersonate: "chrome"}, `{"os": "macos"}`, true},
+		// the default os only applies to impersonating endpoints
+		{&Handler{ImpersonateOS: "macos"}, `{"http": "1.1"}`, true},
+	} {
+		err := c.h.LoadConfig([]byte(`{"/a": {"url": "http://example.com", "browser": ` + c.browser + `, "result": {"title": "h1"}}}`))
+		if c.ok && err != nil {
+			t.Errorf("%s: %s", c.browser, err)
+		} else if !c.ok && (err == nil || !strings.Contains(err.Error(), "only used with impersonate")) {
+			t.Errorf("%s: expected an os error, got %v", c.browser, err)
+		}
+	}
+}
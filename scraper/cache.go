@@ -0,0 +1,212 @@
+package scraper
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cache defaults
+const (
+	defaultCacheEntries = 1000
+	defaultCacheBytes   = 64 << 20
+)
+
+// Cache stores encoded endpoint responses. Keys are prefixed with
+// their endpoint path, followed by a space.
+type Cache interface {
+	// Get returns the unexpired entry stored at key
+	Get(key string) (*CacheEntry, bool)
+	// Set stores an entry at key
+	Set(key string, entry *CacheEntry)
+	// Purge removes all entries whose key has the given
+	// prefix, and returns the number removed
+	Purge(prefix string) int
+}
+
+// CacheEntry is a cached endpoint response
+type CacheEntry struct {
+	Value   []byte    `json:"value"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func (c *CacheEntry) size() int {
+	return len(c.Value)
+}
+
+// MemoryCache is an in-process LRU Cache, bounded by
+// its number of entries and its total size in bytes
+type MemoryCache struct {
+	maxEntries int
+	maxBytes   int
+	mu         sync.Mutex
+	bytes      int
+	lru        *list.List
+	items      map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCache returns a MemoryCache holding at most maxEntries
+// entries and maxBytes bytes. Zero values use the defaults
+// (1000 entries and 64MB).
+func NewMemoryCache(maxEntries, maxBytes int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultCacheBytes
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (c *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := el.Value.(*memoryItem)
+	if !time.Now().Before(item.entry.Expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return item.entry, true
+}
+
+func (c *MemoryCache) Set(key string, entry *CacheEntry) {
+	size := len(key) + entry.size()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if size > c.maxBytes {
+		return
+	}
+	c.items[key] = c.lru.PushFront(&memoryItem{key, entry})
+	c.bytes += size
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *MemoryCache) Purge(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+			n++
+		}
+	}
+	return n
+}
+
+// remove expects the lock to be held
+func (c *MemoryCache) remove(el *list.Element) {
+	item := c.lru.Remove(el).(*memoryItem)
+	delete(c.items, item.key)
+	c.bytes -= len(item.key) + item.entry.size()
+}
+
+// cacheKey identifies a response of the endpoint at path by the
+// request's values and the endpoint's headers. The upstream request
+// is not templated here, since some of its variables (such as pages
+// and the results of before steps) are only known while executing.
+func (e *Endpoint) cacheKey(path string, values map[string]string) string {
+	q := url.Values{}
+	for k, v := range values {
+		q.Set(k, v)
+	}
+	// url.Values encodes its keys sorted
+	return path + " " + requestHash("", q.Encode(), "", e.Headers)
+}
+
+// requestHash is a hex digest of an upstream request
+func requestHash(method, url, body string, headers map[string]string) string {
+	hs := make([]string, 0, len(headers))
+	for k, v := range headers {
+		hs = append(hs, k+": "+v)
+	}
+	sort.Strings(hs)
+	h := sha256.New()
+	for _, s := range append([]string{method, url, body}, hs...) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// flightGroup collapses concurrent fetches of the same key into one.
+// A fetch is canceled once every caller waiting on it has gone.
+type flightGroup struct {
+	mu sync.Mutex
+	m  map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	entry   *CacheEntry
+	err     error
+}
+
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*CacheEntry, error)) (*CacheEntry, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = map[string]*flight{}
+	}
+	f, ok := g.m[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.m[key] = f
+		go func() {
+			f.entry, f.err = fn(fctx)
+			cancel()
+			g.mu.Lock()
+			if g.m[key] == f {
+				delete(g.m, key)
+			}
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+	select {
+	case <-f.done:
+		return f.entry, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if g.m[key] == f {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
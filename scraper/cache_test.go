@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheLRU(t *testing.T) {
+	c := NewMemoryCache(2, 100)
+	entry := func(v string) *CacheEntry {
+		return &CacheEntry{Value: []byte(v), Created: time.Now(), Expires: time.Now().Add(time.Minute)}
+	}
+	c.Set("a", entry("1"))
+	c.Set("b", entry("2"))
+	c.Get("a")
+	c.Set("c", entry("3"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected a")
+	}
+	c.Set("d", entry(strings.Repeat("x", 98)))
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected byte bound to evict a")
+	}
+	if _, ok := c.Get("d"); !ok {
+		t.Error("expected d")
+	}
+	c.Set("e", entry(strings.Repeat("x", 100)))
+	if _, ok := c.Get("e"); ok {
+		t.Error("expected oversized entry to be skipped")
+	}
+	c.Set("f", &CacheEntry{Value: []byte("x"), Expires: time.Now().Add(-time.Second)})
+	if _, ok := c.Get("f"); ok {
+		t.Error("expected expired entry to be missing")
+	}
+	c.Set("p 1", entry("1"))
+	c.Set("p 2", entry("2"))
+	if n := c.Purge("p "); n != 2 {
+		t.Errorf("expected 2 purged, got %d", n)
+	}
+}
+
+func TestHandlerCache(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`<h1>` + r.URL.Query().Get("q") + `</h1>`))
+	}))
+	defer s.Close()
+	h := &Handler{}
+	err := h.LoadConfig([]byte(`{
+		"/search": {"url": "` + s.URL + `?q={{q}}", "result": {"title": "h1"}, "cache": "1m"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(q string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/search?q="+q, nil))
+		return rec
+	}
+	// concurrent misses share one fetch
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := get("a"); rec.Code != 200 || rec.Header().Get("X-Cache") != "MISS" {
+				t.Errorf("unexpected response %d %v", rec.Code, rec.Header())
+			}
+		}()
+	}
+	wg.Wait()
+	if hits != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", hits)
+	}
+	rec := get("a")
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("Age") == "" ||
+		!strings.HasPrefix(rec.Header().Get("Cache-Control"), "public, max-age=") ||
+		!strings.Contains(rec.Body.String(), `"title": "a"`) {
+		t.Fatalf("unexpected cached response %v %s", rec.Header(), rec.Body)
+	}
+	get("b")
+	if hits != 2 {
+		t.Fatalf("expected separate cache entry for other params, got %d requests", hits)
+	}
+	// purge
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", "/?endpoint=/search", nil))
+	if rec.Body.String() != `{"purged":2}` {
+		t.Fatalf("unexpected purge response %s", rec.Body)
+	}
+	if rec := get("a"); rec.Header().Get("X-Cache") != "MISS" || hits != 3 {
+		t.Fatalf("expected miss after purge")
+	}
+	// shared caches may not store authenticated responses
+	h.Auth = "user:pass"
+	req := httptest.NewRequest("GET", "/search?q=a", nil)
+	req.SetBasicAuth("user", "pass")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if cc := rec.Header().Get("Cache-Control"); rec.Code != 200 || !strings.HasPrefix(cc, "private, max-age=") {
+		t.Fatalf("expected a private response, got %d %q", rec.Code, cc)
+	}
+}
+
+func TestHandlerCacheLaterVars(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.Write([]byte(`<li><b>` + r.URL.Query().Get("q") + `</b></li>`))
+		}
+	}))
+	defer s.Close()
+	h := &Handler{}
+	// page is only set while paginating
+	err := h.LoadConfig([]byte(`{
+		"/search": {
+			"url": "` + s.URL + `?q={{q}}&page={{page}}",
+			"list": "li",
+			"result": {"title": "b"},
+			"paginate": {"param": "page", "maxPages": 2},
+			"cache": "1m"
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/search?q=a", nil))
+		if rec.Code != 200 || rec.Header().Get("X-Cache") != status || !strings.Contains(rec.Body.String(), `"title": "a"`) {
+			t.Fatalf("expected %s, got %d %v %s", status, rec.Code, rec.Header(), rec.Body)
+		}
+	}
+}
+
+func TestFlightGroupCancel(t *testing.T) {
+	g := flightGroup{}
+	aborted := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err := g.do(ctx, "k", func(ctx context.Context) (*CacheEntry, error) {
+		<-ctx.Done()
+		close(aborted)
+		return nil, ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("fetch was not canceled after its only waiter left")
+	}
+	// a new caller starts a new fetch
+	e, err := g.do(context.Background(), "k", func(ctx context.Context) (*CacheEntry, error) {
+		return &CacheEntry{Value: []byte("ok")}, nil
+	})
+	if err != nil || string(e.Value) != "ok" {
+		t.Fatalf("got %v %v", e, err)
+	}
+}
@@ -0,0 +1,135 @@
+package scraper
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clientSweep is how often idle clients are forgotten
+const clientSweep = time.Minute
+
+// ClientLimit restricts the requests of each client to the server.
+// Clients are identified by their user, or otherwise by their
+// IP address. Requests over the limit are rejected with
+// 429 Too Many Requests.
+type ClientLimit struct {
+	// Rate is the maximum number of requests per second
+	Rate float64 `json:"rate,omitempty"`
+	// Burst is the number of requests which may exceed Rate
+	// after an idle period (defaults to 1)
+	Burst int `json:"burst,omitempty"`
+	// Concurrency is the maximum number of requests in progress
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// enabled reports whether the limit restricts anything, nil-safe
+func (l *ClientLimit) enabled() bool {
+	return l != nil && (l.Rate > 0 || l.Concurrency > 0)
+}
+
+func (l *ClientLimit) burst() float64 {
+	return float64(max(l.Burst, 1))
+}
+
+// clientLimiter tracks the requests of each client against a ClientLimit
+type clientLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*clientState
+	swept   time.Time
+}
+
+type clientState struct {
+	tokens   float64
+	refilled time.Time
+	inflight int
+}
+
+// allow reports whether the client may make a request. When allowed, the
+// returned func must be called once the request is done. Otherwise, the
+// client should wait for the returned duration before retrying.
+func (c *clientLimiter) allow(client string, l *ClientLimit) (func(), time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.clients == nil {
+		c.clients = map[string]*clientState{}
+		c.swept = now
+	}
+	if now.Sub(c.swept) > clientSweep {
+		c.sweep(now, l)
+	}
+	s, ok := c.clients[client]
+	if !ok {
+		s = &clientState{tokens: l.burst(), refilled: now}
+		c.clients[client] = s
+	}
+	if l.Rate > 0 {
+		s.tokens = min(l.burst(), s.tokens+now.Sub(s.refilled).Seconds()*l.Rate)
+		s.refilled = now
+		if s.tokens < 1 {
+			return nil, time.Duration((1 - s.tokens) / l.Rate * float64(time.Second)), false
+		}
+	}
+	if l.Concurrency > 0 && s.inflight >= l.Concurrency {
+		return nil, time.Second, false
+	}
+	if l.Rate > 0 {
+		s.tokens--
+	}
+	s.inflight++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			s.inflight--
+			c.mu.Unlock()
+		})
+	}, 0, true
+}
+
+// sweep forgets clients with no requests in progress and a
+// full allowance. It expects the lock to be held.
+func (c *clientLimiter) sweep(now time.Time, l *ClientLimit) {
+	for client, s := range c.clients {
+		full := l.Rate <= 0 || s.tokens+now.Sub(s.refilled).Seconds()*l.Rate >= l.burst()
+		if s.inflight == 0 && full {
+			delete(c.clients, client)
+		}
+	}
+	c.swept = now
+}
+
+// clientID identifies the client making the request,
+// by its authenticated user when present
+func clientID(r *http.Request, user *User) string {
+	if user != nil {
+		return "user:" + user.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limitClient applies the client limit to the request, responding
+// with 429 when rejected. When allowed, the returned func must be
+// called once the request is done.
+func limitClient(w http.ResponseWriter, client string, c *clientLimiter, l *ClientLimit) (func(), bool) {
+	if !l.enabled() {
+		return func() {}, true
+	}
+	release, wait, ok := c.allow(client, l)
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(wait.Seconds())), 1)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write(jsonerr(errors.New("too many requests")))
+		return nil, false
+	}
+	return release, true
+}
@@ -0,0 +1,182 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientLimiterRate(t *testing.T) {
+	c := &clientLimiter{}
+	l := &ClientLimit{Rate: 10, Burst: 2}
+	for i := 0; i < 2; i++ {
+		if _, _, ok := c.allow("a", l); !ok {
+			t.Fatalf("request %d: expected burst to be allowed", i)
+		}
+	}
+	_, wait, ok := c.allow("a", l)
+	if ok || wait <= 0 || wait > 100*time.Millisecond {
+		t.Fatalf("expected rejection with a wait up to 100ms, got %v %s", ok, wait)
+	}
+	if _, _, ok := c.allow("b", l); !ok {
+		t.Fatal("expected other clients to be allowed")
+	}
+	time.Sleep(110 * time.Millisecond)
+	if _, _, ok := c.allow("a", l); !ok {
+		t.Fatal("expected allowance to refill")
+	}
+}
+
+func TestClientLimiterConcurrency(t *testing.T) {
+	c := &clientLimiter{}
+	l := &ClientLimit{Concurrency: 1}
+	release, _, ok := c.allow("a", l)
+	if !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	if _, _, ok := c.allow("a", l); ok {
+		t.Fatal("expected concurrent request to be rejected")
+	}
+	release()
+	release()
+	if _, _, ok := c.allow("a", l); !ok {
+		t.Fatal("expected request to be allowed after release")
+	}
+	if _, _, ok := c.allow("a", l); ok {
+		t.Fatal("expected release to only count once")
+	}
+}
+
+func TestHandlerClientLimit(t *testing.T) {
+	rt := &recorder{body: `<h1>ok</h1>`}
+	h := &Handler{Scraper: &Scraper{Transport: rt}, ClientRate: 100, ClientBurst: 3}
+	err := h.LoadConfig([]byte(`{
+		"/a": {"url": "https://example.invalid/a", "result": {"x": "h1"}, "clientLimit": {"rate": 0.5}},
+		"/b": {"url": "https://example.invalid/b", "result": {"x": "h1"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := get("/a", "10.0.0.1"); rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	// endpoint limit
+	rec := get("/a", "10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if s, _ := strconv.Atoi(rec.Header().Get("Retry-After")); s < 1 || s > 2 {
+		t.Fatalf("unexpected Retry-After %q", rec.Header().Get("Retry-After"))
+	}
+	if rec := get("/a", "10.0.0.2"); rec.Code != 200 {
+		t.Fatalf("expected other client to be allowed, got %d", rec.Code)
+	}
+	// handler limit across endpoints
+	if rec := get("/b", "10.0.0.1"); rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec := get("/b", "10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected handler burst to be exhausted, got %d", rec.Code)
+	}
+}
+
+func TestHandlerConfigClientLimit(t *testing.T) {
+	rt := &recorder{body: `<h1>ok</h1>`}
+	h := &Handler{Scraper: &Scraper{Transport: rt}, ClientRate: 100, ClientBurst: 5}
+	config := `{
+		"*": {"clientLimit": {"rate": 0.5, "burst": 3}},
+		"/a": {"url": "https://example.invalid/a", "result": {"x": "h1"}, "clientLimit": {"rate": 0.5}},
+		"/b": {"url": "https://example.invalid/b", "result": {"x": "h1"}}
+	}`
+	if err := h.LoadConfig([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+	if h.clientLimit.Rate != 0.5 || h.clientLimit.Burst != 3 {
+		t.Fatalf("expected the config limit to win over the flags, got %+v", h.clientLimit)
+	}
+	get := func(path string) int {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	if code := get("/a"); code != 200 {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	// endpoint limiter state is kept across reloads
+	if err := h.LoadConfig([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+	if code := get("/a"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the endpoint limit to survive a reload, got %d", code)
+	}
+	if code := get("/b"); code != 200 {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get("/b"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the handler limit across endpoints, got %d", code)
+	}
+	if err := h.LoadConfig([]byte(`{"*": {"url": "https://example.invalid"}}`)); err == nil {
+		t.Fatal("expected other settings under * to be rejected")
+	}
+}
+
+func TestHandlerConfigRoundTrip(t *testing.T) {
+	h := &Handler{}
+	config := `{
+		"*": {"clientLimit": {"rate": 0.5, "burst": 3}},
+		"/a": {"url": "https://example.invalid/a", "result": {"x": "h1"}}
+	}`
+	if err := h.LoadConfig([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.Config[allEndpoints]; ok {
+		t.Fatal("expected * to be left out of the endpoints")
+	}
+	// the config served by GET / may be posted back
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	got := rec.Body.String()
+	if !strings.Contains(got, `"clientLimit"`) || strings.Contains(got, `"url": ""`) {
+		t.Fatalf("unexpected config %s", got)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(got)))
+	if rec.Code != 200 {
+		t.Fatalf("expected the config to load again, got %d %s", rec.Code, rec.Body)
+	}
+	if h.clientLimit.Rate != 0.5 || h.clientLimit.Burst != 3 {
+		t.Fatalf("expected the client limit to be kept, got %+v", h.clientLimit)
+	}
+	// errors are valid JSON, even when quoting
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader(`{"*": {"url": "x"}}`)))
+	var body struct{ Error string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != 400 || err != nil || !strings.Contains(body.Error, `"*"`) {
+		t.Fatalf("expected a JSON error, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestClientID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.SetBasicAuth("alice", "secret")
+	if id := clientID(r, nil); id != "ip:10.0.0.1" {
+		t.Errorf("expected unchecked credentials to be ignored, got %s", id)
+	}
+	if id := clientID(r, &User{Name: "alice"}); id != "user:alice" {
+		t.Errorf("got %s", id)
+	}
+}
@@ -0,0 +1,249 @@
+package scraper
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/itchyny/gojq"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// CSV configures how CSV mode parses the response
+type CSV struct {
+	// Delimiter separates the columns (defaults to ",", use "\t" for TSV)
+	Delimiter string `json:"delimiter,omitempty"`
+	// Header reports whether the first row names the columns (defaults to true)
+	Header *bool `json:"header,omitempty"`
+	// Comment starts lines which are skipped, for example "#"
+	Comment string `json:"comment,omitempty"`
+	// Encoding is the character set of the response, for example
+	// "windows-1252" or "utf-16" (defaults to utf-8)
+	Encoding string `json:"encoding,omitempty"`
+	// Filter is a jq selector which keeps the rows it returns a value
+	// other than false or null for. Rows are objects of their column
+	// names (or indexes) to values.
+	Filter string `json:"filter,omitempty"`
+	// filter is the parsed Filter, set by validate
+	filter *gojq.Query
+}
+
+func (c *CSV) UnmarshalJSON(b []byte) error {
+	type csv CSV
+	if err := json.Unmarshal(b, (*csv)(c)); err != nil {
+		return fmt.Errorf("csv: %w", err)
+	}
+	return c.validate()
+}
+
+func (c *CSV) validate() error {
+	if c.Delimiter != "" && utf8.RuneCountInString(c.Delimiter) != 1 {
+		return fmt.Errorf("csv: delimiter %q must be a single character", c.Delimiter)
+	}
+	if c.Comment != "" && utf8.RuneCountInString(c.Comment) != 1 {
+		return fmt.Errorf("csv: comment %q must be a single character", c.Comment)
+	}
+	if c.Encoding != "" {
+		if _, err := htmlindex.Get(c.Encoding); err != nil {
+			return fmt.Errorf("csv: unknown encoding %q", c.Encoding)
+		}
+	}
+	c.filter = nil
+	if c.Filter != "" {
+		q, err := gojq.Parse(c.Filter)
+		if err != nil {
+			return fmt.Errorf("csv: filter %q: %w", c.Filter, err)
+		}
+		c.filter = q
+	}
+	return nil
+}
+
+// header reports whether the first row names the columns, nil-safe
+func (c *CSV) header() bool {
+	return c == nil || c.Header == nil || *c.Header
+}
+
+// extractCSV extracts a result from each row of a CSV response
+func (e *Endpoint) extractCSV(body io.Reader) ([]Result, string, error) {
+	c := e.CSV
+	if c == nil {
+		c = &CSV{}
+	}
+	filter := c.filter
+	if filter == nil && c.Filter != "" {
+		// not validated, for example when set in Go
+		q, err := gojq.Parse(c.Filter)
+		if err != nil {
+			return nil, "", fmt.Errorf("csv filter %q: %w", c.Filter, err)
+		}
+		filter = q
+	}
+	if c.Encoding != "" {
+		enc, err := htmlindex.Get(c.Encoding)
+		if err != nil {
+			return nil, "", fmt.Errorf("csv: unknown encoding %q", c.Encoding)
+		}
+		body = enc.NewDecoder().Reader(body)
+	}
+	br := bufio.NewReader(body)
+	// skip a utf-8 byte order mark
+	if r, _, err := br.ReadRune(); err == nil && r != '\uFEFF' {
+		br.UnreadRune()
+	}
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if c.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(c.Delimiter)
+	}
+	if c.Comment != "" {
+		reader.Comment, _ = utf8.DecodeRuneInString(c.Comment)
+	}
+	var columns []string
+	if c.header() {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, "", nil
+		} else if err != nil {
+			return nil, "", fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		for _, col := range row {
+			columns = append(columns, strings.TrimSpace(col))
+		}
+	}
+	results := []Result{}
+	for i := 1; ; i++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, "", fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		values := csvRow(columns, row)
+		if filter != nil {
+			keep, err := csvFilter(filter, values)
+			if err != nil {
+				return nil, "", fmt.Errorf("csv filter %q: %w", c.Filter, err)
+			}
+			if !keep {
+				continue
+			}
+		}
+		if len(e.Result) == 0 {
+			r := Result{}
+			for k, v := range values {
+				r[k] = v
+			}
+			results = append(results, r)
+			continue
+		}
+		r, complete := e.extractCSVResult(e.Result, values, row)
+		if complete {
+			results = append(results, r)
+		} else if e.Debug {
+			logf("excluded row #%d: has %d fields, expected %d", i, len(r), len(e.Result))
+		}
+	}
+	if e.Debug {
+		logf("csv: #%d rows", len(results))
+	}
+	return results, "", nil
+}
+
+// extractCSVResult extracts result fields from a row. The first
+// extractor of each field is a column name or a (0-based) column
+// index, and string extractors transform its value. Nested results
+// group columns, since rows have no lists. Reports whether every
+// required field was found.
+func (e *Endpoint) extractCSVResult(fields map[string]Field, values map[string]any, row []string) (Result, bool) {
+	r := Result{}
+	complete := true
+	for field, f := range fields {
+		if f.nested() {
+			if f.List != "" {
+				if e.Debug {
+					logf("field %q: lists are not supported in csv mode", field)
+				}
+				continue
+			}
+			r[field], _ = e.extractCSVResult(f.Result, values, row)
+			continue
+		}
+		ext := f.Extract
+		if len(f.Follow) > 0 {
+			ext = f.Follow
+		}
+		if len(ext) == 0 {
+			if e.Debug {
+				logf("field %q: csv mode expects a column", field)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		value := ""
+		if v, ok := values[ext[0].val]; ok {
+			value = v.(string)
+		} else if i, err := strconv.Atoi(ext[0].val); err == nil && i >= 0 && i < len(row) {
+			value = row[i]
+		}
+		for _, x := range ext[1:] {
+			if stringExtractor(x.val) {
+				value, _ = x.fn(value, &goquery.Selection{})
+			} else if e.Debug {
+				logf("field %q: %s is not supported in csv mode", field, x.val)
+			}
+		}
+		if value == "" {
+			if e.Debug {
+				logf("missing %s", field)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		if len(f.Follow) > 0 {
+			r[field] = value
+		} else if cv, err := f.convert(value); err == nil {
+			r[field] = cv
+		} else if e.Debug {
+			logf("field %q: %v", field, err)
+		}
+	}
+	return r, complete
+}
+
+// csvRow maps the column names, or indexes when
+// there are no names, of a row to its values
+func csvRow(columns, row []string) map[string]any {
+	fields := make(map[string]any, len(row))
+	for i, v := range row {
+		k := strconv.Itoa(i)
+		if i < len(columns) && columns[i] != "" {
+			k = columns[i]
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// csvFilter reports whether the jq filter returns a
+// value other than false or null for the row
+func csvFilter(filter *gojq.Query, fields map[string]any) (bool, error) {
+	items, err := runQuery(fields, filter)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range items {
+		if v != nil && v != false {
+			return true, nil
+		}
+	}
+	return false, nil
+}
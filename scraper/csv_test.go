@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const productsCSV = "\ufeffsku, name ,price\n" +
+	"# discontinued\n" +
+	"a1,\"Widget, large\",$4.50\n" +
+	"b2,Gadget,\n" +
+	"c3,Gizmo,$12\n"
+
+func TestExtractCSV(t *testing.T) {
+	e := &Endpoint{
+		Mode: "csv",
+		CSV:  &CSV{Comment: "#", Filter: `.price != ""`},
+		Result: map[string]Field{
+			"id":    {Extract: mustExtractors(t, "sku", "s/^./X/")},
+			"name":  {Extract: mustExtractors(t, "1", "/^(\\w+)/")},
+			"price": {Extract: mustExtractors(t, "price", "s/\\$//"), Type: typeFloat},
+			"meta":  {Result: map[string]Field{"sku": {Extract: mustExtractors(t, "0")}}},
+		},
+	}
+	res, _, err := e.extractCSV(strings.NewReader(productsCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"id":"X1","meta":{"sku":"a1"},"name":"Widget","price":4.5},{"id":"X3","meta":{"sku":"c3"},"name":"Gizmo","price":12}]`
+	if b, _ := json.Marshal(res); string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+	// without a filter, rows missing fields are excluded
+	e.CSV.Filter = ""
+	if res, _, _ := e.extractCSV(strings.NewReader(productsCSV)); len(res) != 2 {
+		t.Fatalf("expected 2 rows, got %v", res)
+	}
+	e.CSV.Filter = ".["
+	if _, _, err := e.extractCSV(strings.NewReader(productsCSV)); err == nil {
+		t.Fatal("expected a filter error")
+	}
+}
+
+func TestExtractCSVOptions(t *testing.T) {
+	no := false
+	latin1, _ := charmap.Windows1252.NewEncoder().String("1\tcafé\n2\tnaïve\n")
+	e := &Endpoint{Mode: "csv", CSV: &CSV{Delimiter: "\t", Header: &no, Encoding: "windows-1252"}}
+	res, _, err := e.extractCSV(strings.NewReader(latin1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"0":"1","1":"café"},{"0":"2","1":"naïve"}]`
+	if b, _ := json.Marshal(res); string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+}
+
+func TestCSVConfig(t *testing.T) {
+	for _, s := range []string{`{"delimiter": ";;"}`, `{"comment": "//"}`, `{"encoding": "nope"}`, `{"filter": ".["}`} {
+		if err := json.Unmarshal([]byte(s), &CSV{}); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+	var c CSV
+	if err := json.Unmarshal([]byte(`{"delimiter": "\t", "header": false, "encoding": "utf-16"}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Delimiter != "\t" || c.header() {
+		t.Fatalf("unexpected config %+v", c)
+	}
+}
+
+func TestCSVEndpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Product Name;Price\n Widget ;$4.50\n"))
+	}))
+	defer ts.Close()
+	e := &Endpoint{}
+	config := `{
+		"mode": "csv",
+		"url": "` + ts.URL + `",
+		"csv": {"delimiter": ";"},
+		"result": {
+			"name": ["Product Name", "trim()"],
+			"price": {"extract": ["1", "s/\\$//"], "type": "float"}
+		}
+	}`
+	if err := json.Unmarshal([]byte(config), e); err != nil {
+		t.Fatal(err)
+	}
+	e.Scraper = &Scraper{Transport: http.DefaultTransport}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["name"] != "Widget" || res[0]["price"] != 4.5 {
+		t.Fatalf("unexpected results %v", res)
+	}
+}
+
+func TestCSVHandlerOneRow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer ts.Close()
+	h := &Handler{}
+	if err := h.LoadConfig([]byte(`{"/c": {"mode": "csv", "url": "` + ts.URL + `", "csv": {"filter": ".a == \"1\""}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/c", nil))
+	// a csv file is an array, whatever its number of rows
+	var res []map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res) != 1 || res[0]["b"] != "2" {
+		t.Fatalf("expected an array of one row, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,236 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiskCache stores raw upstream responses (status, headers and body)
+// as files under Dir, so they survive restarts. Set it as a Scraper's
+// Cache to replay responses instead of fetching them again. Only
+// successful and client error responses are cached, excluding 408
+// and 429. The zero value with a Dir is ready to use.
+type DiskCache struct {
+	// Dir is the cache directory, created when missing
+	Dir string
+	// TTL is how long responses are kept (zero keeps them until evicted)
+	TTL time.Duration
+	// MaxBytes bounds the size of Dir, evicting the least recently
+	// used responses when exceeded (zero is unbounded)
+	MaxBytes int64
+	mu       sync.Mutex
+	size     int64
+	sized    bool
+}
+
+// diskEntry is the first line of a cache file, which is followed by the body
+type diskEntry struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	URL        string      `json:"url"`
+	Created    time.Time   `json:"created"`
+}
+
+// cacheable reports whether an upstream status may be cached
+func cacheable(status int) bool {
+	return status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// get returns the cached response stored at key
+func (c *DiskCache) get(key string) (*response, bool) {
+	p := c.path(key)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, false
+	}
+	var d diskEntry
+	if err := json.Unmarshal(line, &d); err != nil {
+		return nil, false
+	}
+	if c.TTL > 0 && time.Since(d.Created) > c.TTL {
+		c.remove(p)
+		return nil, false
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, false
+	}
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return nil, false
+	}
+	// the modification time records the last use
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return &response{
+		StatusCode: d.StatusCode,
+		Header:     d.Header,
+		URL:        u,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}, true
+}
+
+// set stores the response at key, reading its body.
+// It returns a replacement response with the body in memory.
+func (c *DiskCache) set(key string, resp *response) (*response, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	out := *resp
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	line, err := json.Marshal(diskEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		URL:        resp.URL.String(),
+		Created:    time.Now(),
+	})
+	if err != nil {
+		return &out, nil
+	}
+	// caching is best effort, failures still return the response
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		logf("disk cache: %s", err)
+		return &out, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		logf("disk cache: %s", err)
+		return &out, nil
+	}
+	_, err = tmp.Write(append(line, '\n'))
+	if err == nil {
+		_, err = tmp.Write(body)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logf("disk cache: %s", err)
+		return &out, nil
+	}
+	c.added(int64(len(line) + 1 + len(body)))
+	return &out, nil
+}
+
+// remove deletes the cache file at p
+func (c *DiskCache) remove(p string) {
+	info, err := os.Stat(p)
+	if err != nil || os.Remove(p) != nil {
+		return
+	}
+	c.mu.Lock()
+	c.size -= info.Size()
+	c.mu.Unlock()
+}
+
+// added records n new bytes, evicting when over MaxBytes
+func (c *DiskCache) added(n int64) {
+	if c.MaxBytes <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += n
+	if c.sized && c.size <= c.MaxBytes {
+		return
+	}
+	c.evict()
+}
+
+// evict recounts the size of Dir, and removes the least
+// recently used files until it is within MaxBytes.
+// It expects the lock to be held.
+func (c *DiskCache) evict() {
+	type file struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var files []file
+	var size int64
+	filepath.WalkDir(c.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isCacheFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{p, info.Size(), info.ModTime()})
+		size += info.Size()
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].used.Before(files[j].used)
+	})
+	for _, f := range files {
+		if size <= c.MaxBytes {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			size -= f.size
+		}
+	}
+	c.size = size
+	c.sized = true
+}
+
+// Purge removes every cached response
+func (c *DiskCache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := filepath.WalkDir(c.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !isCacheFile(d.Name()) {
+			return nil
+		}
+		return os.Remove(p)
+	})
+	c.size = 0
+	c.sized = false
+	return err
+}
+
+// isCacheFile reports whether name is a cache file, so
+// files not written by the cache are never removed
+func isCacheFile(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Page", r.URL.Path)
+		w.Write([]byte(`<h1>` + r.URL.Path + `</h1>`))
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	type result struct {
+		Title string `scraper:"h1"`
+	}
+	type endpoint struct {
+		URL    string
+		Result result
+	}
+	for i := 0; i < 2; i++ {
+		// a new Scraper, as if the process restarted
+		s := &Scraper{Cache: &DiskCache{Dir: dir}}
+		e := endpoint{URL: ts.URL + "/a"}
+		if err := s.Execute(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Result.Title != "/a" {
+			t.Fatalf("got %+v", e.Result)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expected 1 upstream request, got %d", hits)
+	}
+	c := &DiskCache{Dir: dir}
+	resp, ok := c.get(requestHash(http.MethodGet, ts.URL+"/a", "", nil))
+	if !ok || resp.StatusCode != 200 || resp.Header.Get("X-Page") != "/a" || resp.URL.String() != ts.URL+"/a" {
+		t.Fatalf("unexpected cached response %+v", resp)
+	}
+	// server errors are not cached
+	s := &Scraper{Cache: c}
+	for i := 0; i < 2; i++ {
+		s.Execute(&endpoint{URL: ts.URL + "/missing"})
+	}
+	if hits != 3 {
+		t.Fatalf("expected server errors to be fetched again, got %d requests", hits)
+	}
+	if err := c.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	s.Execute(&endpoint{URL: ts.URL + "/a"})
+	if hits != 4 {
+		t.Fatalf("expected purge to clear the cache, got %d requests", hits)
+	}
+}
+
+func TestDiskCacheTTL(t *testing.T) {
+	rt := &recorder{body: `<h1>Hello</h1>`}
+	s := &Scraper{Transport: rt, Cache: &DiskCache{Dir: t.TempDir(), TTL: 50 * time.Millisecond}}
+	e := &Endpoint{
+		URL:     "https://example.invalid/",
+		Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+		Scraper: s,
+	}
+	e.Execute(nil)
+	e.Execute(nil)
+	if len(rt.reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(rt.reqs))
+	}
+	time.Sleep(60 * time.Millisecond)
+	e.Execute(nil)
+	if len(rt.reqs) != 2 {
+		t.Fatalf("expected expired response to be fetched again, got %d requests", len(rt.reqs))
+	}
+}
+
+func TestDiskCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	// unrelated files are never removed
+	other := filepath.Join(dir, "keep.txt")
+	os.WriteFile(other, []byte(strings.Repeat("x", 1000)), 0o644)
+	rt := &recorder{body: strings.Repeat("x", 400)}
+	s := &Scraper{Transport: rt, Cache: &DiskCache{Dir: dir, MaxBytes: 1000}}
+	e := &Endpoint{
+		URL:     "https://example.invalid/{{page}}",
+		Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+		Scraper: s,
+	}
+	for _, page := range []string{"1", "2", "3", "1"} {
+		e.Execute(map[string]string{"page": page})
+	}
+	if len(rt.reqs) != 4 {
+		t.Fatalf("expected page 1 to be evicted, got %d requests", len(rt.reqs))
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if !info.IsDir() && p != other {
+			size += info.Size()
+		}
+		return nil
+	})
+	if size > 1000 {
+		t.Fatalf("cache is %d bytes", size)
+	}
+}
@@ -1,137 +1,238 @@
 package scraper
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/enetx/g"
-	"github.com/enetx/surf"
 	"github.com/itchyny/gojq"
 )
 
-// shared HTTP client — reuses connection pool across requests
-var client = surf.NewClient()
-
 // Endpoint represents a single remote endpoint. The performed
 // query can be modified between each call by parameterising
 // URL. See documentation.
 type Endpoint struct {
-	Name    string                `json:"name,omitempty"`
-	Mode    string                `json:"mode,omitempty"`
-	Method  string                `json:"method,omitempty"`
-	URL     string                `json:"url"`
-	Body    string                `json:"body,omitempty"`
-	Headers map[string]string     `json:"headers,omitempty"`
-	List    string                `json:"list,omitempty"`
-	Result  map[string]Extractors `json:"result"`
-	Debug   bool
+	Name         string            `json:"name,omitempty"`
+	Mode         string            `json:"mode,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	URL          string            `json:"url"`
+	Body         string            `json:"body,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Timeout      Duration          `json:"timeout,omitempty"`
+	Retry        *Retry            `json:"retry,omitempty"`
+	ExpectStatus StatusRules       `json:"expectStatus,omitempty"`
+	Cache        Duration          `json:"cache,omitempty"`
+	Limit        *Limit            `json:"limit,omitempty"`
+	Proxy        *Proxy            `json:"proxy,omitempty"`
+	Browser      *Browser          `json:"browser,omitempty"`
+	ClientLimit  *ClientLimit      `json:"clientLimit,omitempty"`
+	Session      *Session          `json:"session,omitempty"`
+	Before       []Step            `json:"before,omitempty"`
+	LoggedOut    *LoggedOut        `json:"loggedOut,omitempty"`
+	List         string            `json:"list,omitempty"`
+	Namespaces   map[string]string `json:"namespaces,omitempty"`
+	CSV          *CSV              `json:"csv,omitempty"`
+	Table        *Table            `json:"table,omitempty"`
+	Paginate     *Paginate         `json:"paginate,omitempty"`
+	Result       map[string]Field  `json:"result"`
+	Debug        bool
+	Scraper      *Scraper `json:"-"`
+	clients      *clientLimiter
+	login        *login
+	xpaths       xpathExprs
 }
 
-// extract 1 result using this endpoints extractor map
-func (e *Endpoint) extract(sel *goquery.Selection) Result {
+// extract 1 result using the given field map, and reports whether
+// every required field was found. Follow fields extract their link,
+// which is later replaced by e.follow.
+func (e *Endpoint) extract(fields map[string]Field, sel *goquery.Selection) (Result, bool) {
 	r := Result{}
-	for field, ext := range e.Result {
-		if v := ext.execute(sel); v != "" {
+	complete := true
+	for field, f := range fields {
+		if f.nested() {
+			r[field] = e.extractNested(f, sel)
+			continue
+		}
+		ext := f.Extract
+		if len(f.Follow) > 0 {
+			ext = f.Follow
+		}
+		v := ext.execute(sel)
+		if v == "" {
+			if e.Debug {
+				logf("missing %s", field)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		if len(f.Follow) > 0 {
 			r[field] = v
+		} else if cv, err := f.convert(v); err == nil {
+			r[field] = cv
 		} else if e.Debug {
-			logf("missing %s", field)
+			logf("field %q: %v", field, err)
 		}
 	}
-	return r
+	return r, complete
+}
+
+// extractNested extracts a nested object, or a list of
+// nested objects, relative to the current selection
+func (e *Endpoint) extractNested(f Field, sel *goquery.Selection) any {
+	if f.List == "" {
+		r, _ := e.extract(f.Result, sel)
+		return r
+	}
+	results := []Result{}
+	sel.Find(f.List).Each(func(i int, sel *goquery.Selection) {
+		if r, complete := e.extract(f.Result, sel); complete {
+			results = append(results, r)
+		}
+	})
+	return results
 }
 
 // Execute will execute an Endpoint with the given params
 func (e *Endpoint) Execute(params map[string]string) ([]Result, error) {
-	url, err := template(true, e.URL, params)
-	if err != nil {
-		return nil, err
-	}
-	method := e.Method
-	if method == "" {
-		method = http.MethodGet
+	return e.ExecuteContext(context.Background(), params)
+}
+
+// ExecuteContext will execute an Endpoint with the given params. Upstream
+// requests are aborted when ctx is done, in which case ctx.Err() is returned
+// (context.Canceled or context.DeadlineExceeded).
+func (e *Endpoint) ExecuteContext(ctx context.Context, params map[string]string) ([]Result, error) {
+	if len(e.Before) > 0 {
+		return e.executeLogin(ctx, params)
 	}
-	req, err := newRequest(method, url)
-	if err != nil {
-		return nil, err
+	return e.execute(ctx, params)
+}
+
+// execute fetches and extracts every page of the endpoint
+func (e *Endpoint) execute(ctx context.Context, params map[string]string) ([]Result, error) {
+	if e.Paginate != nil {
+		return e.Paginate.execute(ctx, e, params)
 	}
-	if e.Body != "" {
-		body, err := template(true, e.Body, params)
-		if err != nil {
-			return nil, err
+	results, _, err := e.executePage(ctx, params, "")
+	return results, err
+}
+
+// executePage fetches and extracts a single page. An empty url uses the
+// endpoint's URL template, otherwise url is fetched as-is with GET. The
+// returned next is the absolute URL of the following page, when the
+// endpoint paginates by link and one was found.
+func (e *Endpoint) executePage(ctx context.Context, params map[string]string, url string) (results []Result, next string, err error) {
+	method := http.MethodGet
+	body := ""
+	if url == "" {
+		if url, err = template(true, e.URL, params); err != nil {
+			return nil, "", err
 		}
-		req = req.Body(body)
-		if e.Debug {
-			logf("req: %s %s (body size %d)", method, url, len(body))
+		if e.Method != "" {
+			method = e.Method
 		}
-	} else if e.Debug {
-		logf("req: %s %s", method, url)
-	}
-	if len(e.Headers) > 0 {
-		headers := make([]any, 0, len(e.Headers)*2)
-		for k, v := range e.Headers {
-			headers = append(headers, k, v)
-			if e.Debug {
-				logf("header: %s=%s", k, v)
+		if e.Body != "" {
+			if body, err = template(true, e.Body, params); err != nil {
+				return nil, "", err
 			}
 		}
-		req = req.AddHeaders(headers...)
 	}
-
-	result := req.Do()
-	if result.IsErr() {
-		return nil, result.Err()
+	resp, err := e.fetch(ctx, method, url, body)
+	if err != nil {
+		var uerr *UpstreamError
+		if len(e.Before) > 0 && errors.As(err, &uerr) && uerr.StatusCode != 0 && e.LoggedOut.status(uerr.StatusCode) {
+			return nil, "", errLoggedOut
+		}
+		return nil, "", err
 	}
-	resp := result.Ok()
-	defer resp.Body.Close()
-
-	if e.Debug {
-		logf("resp: %d (type: %s)", resp.StatusCode, resp.Headers.Get("Content-Type"))
+	if len(e.Before) > 0 {
+		out, err := e.loggedOut(resp)
+		if err != nil || out {
+			resp.Body.Close()
+			if out {
+				err = errLoggedOut
+			}
+			return nil, "", err
+		}
 	}
+	defer resp.Body.Close()
 
-	mode := e.Mode
-	if mode == "" {
-		mode = "html"
-	}
-	switch mode {
+	switch mode := e.mode(); mode {
 	case "html":
-		return e.extractHTML(resp.Body.Reader)
+		results, next, err = e.extractHTML(resp.Body)
 	case "json":
-		return e.extractJSON(resp.Body.Reader)
+		results, next, err = e.extractJSON(resp.Body)
+	case "xml":
+		results, next, err = e.extractXML(resp.Body)
+	case "feed":
+		results, next, err = e.extractFeed(resp.Body)
+	case "csv":
+		results, next, err = e.extractCSV(resp.Body)
+	case "table":
+		results, next, err = e.extractTable(resp.Body)
 	default:
-		return nil, fmt.Errorf("unknown mode %q (expected \"html\" or \"json\")", mode)
+		return nil, "", fmt.Errorf("unknown mode %q (expected \"html\", \"json\", \"xml\", \"feed\", \"csv\" or \"table\")", mode)
 	}
+	// done with the page: release its host limit before following
+	// detail pages, which may need the same host
+	resp.Body.Close()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			// endpoint timeout while reading the body
+			return nil, "", &UpstreamError{URL: url, StatusCode: resp.StatusCode, Err: err}
+		}
+		return nil, "", err
+	}
+	if next != "" {
+		next = resolveURL(resp.URL, next)
+	}
+	e.follow(ctx, e.Result, results, resp.URL)
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return results, next, nil
+}
+
+// mode returns the endpoint mode, defaulting to html
+func (e *Endpoint) mode() string {
+	if e.Mode == "" {
+		return "html"
+	}
+	return e.Mode
 }
 
-// newRequest builds a surf request for the given method. surf no longer
-// exposes a generic dispatch — each verb has its own builder method.
-func newRequest(method, url string) (*surf.Request, error) {
-	u := g.String(url)
-	switch method {
-	case http.MethodGet:
-		return client.Get(u), nil
-	case http.MethodPost:
-		return client.Post(u), nil
-	case http.MethodPut:
-		return client.Put(u), nil
-	case http.MethodPatch:
-		return client.Patch(u), nil
-	case http.MethodDelete:
-		return client.Delete(u), nil
-	case http.MethodHead:
-		return client.Head(u), nil
+// single reports whether the endpoint extracts a single result, which
+// the server responds with as an object. Feed, csv and table endpoints
+// always respond with a list.
+func (e *Endpoint) single() bool {
+	switch e.mode() {
+	case "html", "json", "xml":
+		return e.List == ""
 	}
-	return nil, fmt.Errorf("unsupported HTTP method %q", method)
+	return false
 }
 
-// extractHTML extracts results from an HTML response using CSS selectors
-func (e *Endpoint) extractHTML(body io.Reader) ([]Result, error) {
+// scraper returns the Scraper used by this endpoint
+func (e *Endpoint) scraper() *Scraper {
+	if e.Scraper != nil {
+		return e.Scraper
+	}
+	return DefaultScraper
+}
+
+// extractHTML extracts results from an HTML response using CSS selectors,
+// along with the (possibly relative) next page link
+func (e *Endpoint) extractHTML(body io.Reader) ([]Result, string, error) {
 	doc, err := goquery.NewDocumentFromReader(body)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	sel := doc.Selection
 	var results []Result
@@ -146,24 +247,30 @@ func (e *Endpoint) extractHTML(body io.Reader) ([]Result, error) {
 			}
 		}
 		sels.Each(func(i int, sel *goquery.Selection) {
-			r := e.extract(sel)
-			if len(r) == len(e.Result) {
+			r, complete := e.extract(e.Result, sel)
+			if complete {
 				results = append(results, r)
 			} else if e.Debug {
 				logf("excluded #%d: has %d fields, expected %d", i, len(r), len(e.Result))
 			}
 		})
 	} else {
-		results = append(results, e.extract(sel))
+		r, _ := e.extract(e.Result, sel)
+		results = append(results, r)
 	}
-	return results, nil
+	next := ""
+	if p := e.Paginate; p != nil && len(p.Next) > 0 {
+		next = p.Next.execute(sel)
+	}
+	return results, next, nil
 }
 
-// extractJSON extracts results from a JSON response using jq selectors
-func (e *Endpoint) extractJSON(body io.Reader) ([]Result, error) {
+// extractJSON extracts results from a JSON response using jq selectors,
+// along with the (possibly relative) next page link
+func (e *Endpoint) extractJSON(body io.Reader) ([]Result, string, error) {
 	var data any
 	if err := json.NewDecoder(body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		return nil, "", fmt.Errorf("failed to parse JSON: %w", err)
 	}
 	listSelector := e.List
 	if listSelector == "" {
@@ -171,35 +278,57 @@ func (e *Endpoint) extractJSON(body io.Reader) ([]Result, error) {
 	}
 	items, err := runJQ(data, listSelector)
 	if err != nil {
-		return nil, fmt.Errorf("list selector %q: %w", listSelector, err)
+		return nil, "", fmt.Errorf("list selector %q: %w", listSelector, err)
 	}
 	if e.Debug {
 		logf("list: %s => #%d elements", listSelector, len(items))
 	}
 	results := make([]Result, 0, len(items))
 	for _, item := range items {
-		r := e.extractJSONResult(item)
+		r := e.extractJSONResult(e.Result, item)
 		if len(r) > 0 {
 			results = append(results, r)
 		}
 	}
-	return results, nil
+	next := ""
+	if p := e.Paginate; p != nil && len(p.Next) > 0 {
+		sel := jqPipeline(p.Next)
+		matches, err := runJQ(data, sel)
+		if err != nil {
+			return nil, "", fmt.Errorf("next selector %q: %w", sel, err)
+		}
+		if len(matches) > 0 {
+			next = jsonValueString(matches[0])
+		}
+	}
+	return results, next, nil
 }
 
 // extractJSONResult extracts result fields from a single item.
 // An extractor list is treated as a jq pipeline: ["a", "b", "c"] becomes
 // "a | b | c" — matching the chaining semantics of HTML-mode extractors.
-func (e *Endpoint) extractJSONResult(item any) Result {
+func (e *Endpoint) extractJSONResult(fields map[string]Field, item any) Result {
 	r := Result{}
-	for field, extractors := range e.Result {
-		if len(extractors) == 0 {
+	for field, f := range fields {
+		if f.nested() {
+			v, err := e.extractJSONNested(f, item)
+			if err != nil {
+				if e.Debug {
+					logf("field %q (%s): %v", field, f.List, err)
+				}
+				continue
+			}
+			r[field] = v
 			continue
 		}
-		parts := make([]string, len(extractors))
-		for i, ex := range extractors {
-			parts[i] = ex.val
+		extractors := f.Extract
+		if len(f.Follow) > 0 {
+			extractors = f.Follow
+		}
+		if len(extractors) == 0 {
+			continue
 		}
-		sel := strings.Join(parts, " | ")
+		sel := jqPipeline(extractors)
 		matches, err := runJQ(item, sel)
 		if err != nil {
 			if e.Debug {
@@ -210,17 +339,58 @@ func (e *Endpoint) extractJSONResult(item any) Result {
 		if len(matches) == 0 {
 			continue
 		}
-		r[field] = jsonValueString(matches[0])
+		if len(f.Follow) > 0 {
+			r[field] = jsonValueString(matches[0])
+		} else if f.Type == typeRaw {
+			r[field] = matches[0]
+		} else if v, err := f.convert(matches[0]); err == nil {
+			r[field] = v
+		} else if e.Debug {
+			logf("field %q (%s): %v", field, sel, err)
+		}
 	}
 	return r
 }
 
+// extractJSONNested extracts a nested object, or a list of
+// nested objects, relative to the current item
+func (e *Endpoint) extractJSONNested(f Field, item any) (any, error) {
+	if f.List == "" {
+		return e.extractJSONResult(f.Result, item), nil
+	}
+	items, err := runJQ(item, f.List)
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	for _, item := range items {
+		if r := e.extractJSONResult(f.Result, item); len(r) > 0 {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// jqPipeline joins an extractor list into a single jq program
+func jqPipeline(extractors Extractors) string {
+	parts := make([]string, len(extractors))
+	for i, ex := range extractors {
+		parts[i] = ex.val
+	}
+	return strings.Join(parts, " | ")
+}
+
 // runJQ compiles and runs a jq selector against data, returning all matches.
 func runJQ(data any, selector string) ([]any, error) {
 	query, err := gojq.Parse(selector)
 	if err != nil {
 		return nil, fmt.Errorf("parse: %w", err)
 	}
+	return runQuery(data, query)
+}
+
+// runQuery runs a parsed jq query against data, returning all matches.
+func runQuery(data any, query *gojq.Query) ([]any, error) {
 	var items []any
 	iter := query.Run(data)
 	for {
@@ -236,8 +406,8 @@ func runJQ(data any, selector string) ([]any, error) {
 	return items, nil
 }
 
-// jsonValueString converts a jq result value into a string suitable for
-// inclusion in a Result map. Scalars use their natural string form;
+// jsonValueString converts a jq result value into a string, as used
+// by the "string" field type. Scalars use their natural string form;
 // objects/arrays are re-encoded as JSON.
 func jsonValueString(v any) string {
 	switch x := v.(type) {
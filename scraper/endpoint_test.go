@@ -1,8 +1,16 @@
 package scraper
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/enetx/surf"
 )
 
 func TestJSONValueString(t *testing.T) {
@@ -47,16 +55,16 @@ func mustExtractors(t *testing.T, vals ...string) Extractors {
 func TestExtractHTML(t *testing.T) {
 	e := &Endpoint{
 		List: ".item",
-		Result: map[string]Extractors{
-			"name": mustExtractors(t, "h2"),
-			"href": mustExtractors(t, "a", "@href"),
+		Result: map[string]Field{
+			"name": {Extract: mustExtractors(t, "h2")},
+			"href": {Extract: mustExtractors(t, "a", "@href")},
 		},
 	}
 	body := strings.NewReader(`
 		<div class="item"><h2>One</h2><a href="/1">x</a></div>
 		<div class="item"><h2>Two</h2><a href="/2">x</a></div>
 	`)
-	res, err := e.extractHTML(body)
+	res, _, err := e.extractHTML(body)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -74,16 +82,16 @@ func TestExtractHTML(t *testing.T) {
 func TestExtractHTMLSkipsIncompleteRows(t *testing.T) {
 	e := &Endpoint{
 		List: ".item",
-		Result: map[string]Extractors{
-			"name": mustExtractors(t, "h2"),
-			"href": mustExtractors(t, "a", "@href"),
+		Result: map[string]Field{
+			"name": {Extract: mustExtractors(t, "h2")},
+			"href": {Extract: mustExtractors(t, "a", "@href")},
 		},
 	}
 	body := strings.NewReader(`
 		<div class="item"><h2>One</h2><a href="/1">x</a></div>
 		<div class="item"><h2>Missing href</h2></div>
 	`)
-	res, err := e.extractHTML(body)
+	res, _, err := e.extractHTML(body)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -96,23 +104,24 @@ func TestExtractJSON(t *testing.T) {
 	e := &Endpoint{
 		Mode: "json",
 		List: ".items[]",
-		Result: map[string]Extractors{
-			"name":  mustExtractors(t, ".name"),
-			"count": mustExtractors(t, ".count"),
+		Result: map[string]Field{
+			"name":  {Extract: mustExtractors(t, ".name")},
+			"count": {Extract: mustExtractors(t, ".count")},
 		},
 	}
 	body := strings.NewReader(`{"items":[{"name":"a","count":1},{"name":"b","count":2}]}`)
-	res, err := e.extractJSON(body)
+	res, _, err := e.extractJSON(body)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if len(res) != 2 {
 		t.Fatalf("got %d results, want 2", len(res))
 	}
-	if res[0]["name"] != "a" || res[0]["count"] != "1" {
+	// untyped jq values pass through as JSON numbers
+	if res[0]["name"] != "a" || res[0]["count"] != 1.0 {
 		t.Errorf("result[0] = %+v", res[0])
 	}
-	if res[1]["name"] != "b" || res[1]["count"] != "2" {
+	if res[1]["name"] != "b" || res[1]["count"] != 2.0 {
 		t.Errorf("result[1] = %+v", res[1])
 	}
 }
@@ -121,17 +130,17 @@ func TestExtractJSONChaining(t *testing.T) {
 	e := &Endpoint{
 		Mode: "json",
 		List: ".items[]",
-		Result: map[string]Extractors{
+		Result: map[string]Field{
 			// pipeline: extract count, multiply by 10
-			"big": mustExtractors(t, ".count", ". * 10"),
+			"big": {Extract: mustExtractors(t, ".count", ". * 10")},
 		},
 	}
 	body := strings.NewReader(`{"items":[{"count":1},{"count":2}]}`)
-	res, err := e.extractJSON(body)
+	res, _, err := e.extractJSON(body)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(res) != 2 || res[0]["big"] != "10" || res[1]["big"] != "20" {
+	if len(res) != 2 || res[0]["big"] != 10.0 || res[1]["big"] != 20.0 {
 		t.Errorf("got %+v", res)
 	}
 }
@@ -153,8 +162,153 @@ func TestExecuteUnknownMode(t *testing.T) {
 }
 
 func TestNewRequestRejectsUnknownMethod(t *testing.T) {
-	_, err := newRequest("CONNECT", "https://example.com")
+	_, err := newRequest(surf.NewClient(), "CONNECT", "https://example.com")
 	if err == nil {
 		t.Fatal("expected error for unsupported method")
 	}
 }
+
+func TestExtractTypedFields(t *testing.T) {
+	var e Endpoint
+	err := json.Unmarshal([]byte(`{
+		"list": ".item",
+		"result": {
+			"name": "h2",
+			"price": {"extract": ".price", "type": "float"},
+			"stock": {"extract": ".stock", "type": "int"},
+			"tags": {"extract": ".tag", "type": "array"}
+		}
+	}`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.NewReader(`
+		<div class="item"><h2>One</h2><b class="price">1.5</b><b class="stock">3</b><i class="tag">a</i><i class="tag">b</i></div>
+		<div class="item"><h2>Bad</h2><b class="price">2</b><b class="stock">n/a</b><i class="tag">a</i></div>
+	`)
+	res, _, err := e.extractHTML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unconvertible values are left out, without dropping the row
+	b, _ := json.Marshal(res)
+	if want := `[{"name":"One","price":1.5,"stock":3,"tags":["a","b"]},{"name":"Bad","price":2,"tags":["a"]}]`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestExtractJSONTypedFields(t *testing.T) {
+	var e Endpoint
+	err := json.Unmarshal([]byte(`{
+		"mode": "json",
+		"list": ".items[]",
+		"result": {
+			"id": {"extract": ".id", "type": "string"},
+			"tags": ".tags",
+			"meta": ".meta",
+			"ok": ".ok",
+			"stock": {"extract": ".stock", "type": "int"}
+		}
+	}`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.NewReader(`{"items":[{"id":7,"tags":[1,2],"meta":{"k":"v"},"ok":true,"stock":3},{"id":8,"stock":"n/a"}]}`)
+	res, _, err := e.extractJSON(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(res)
+	if want := `[{"id":"7","meta":{"k":"v"},"ok":true,"stock":3,"tags":[1,2]},{"id":"8","meta":null,"ok":null,"tags":null}]`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestExtractNested(t *testing.T) {
+	var e Endpoint
+	err := json.Unmarshal([]byte(`{
+		"list": ".product",
+		"result": {
+			"name": "h2",
+			"brand": {"result": {"name": ".brand", "url": [".brand", "@href"]}},
+			"variants": {
+				"list": ".variant",
+				"result": {
+					"name": ".name",
+					"price": {"extract": ".price", "type": "float"}
+				}
+			}
+		}
+	}`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.NewReader(`
+		<div class="product">
+			<h2>Shirt</h2><a class="brand" href="/acme">Acme</a>
+			<ul>
+				<li class="variant"><span class="name">S</span><span class="price">10</span></li>
+				<li class="variant"><span class="name">M</span><span class="price">12.5</span></li>
+			</ul>
+		</div>
+		<div class="product"><h2>Hat</h2></div>
+	`)
+	res, _, err := e.extractHTML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(res)
+	want := `[{"brand":{"name":"Acme","url":"/acme"},"name":"Shirt","variants":[{"name":"S","price":10},{"name":"M","price":12.5}]},` +
+		`{"brand":{},"name":"Hat","variants":[]}]`
+	if string(b) != want {
+		t.Errorf("got %s\nwant %s", b, want)
+	}
+}
+
+func TestExtractJSONNested(t *testing.T) {
+	var e Endpoint
+	err := json.Unmarshal([]byte(`{
+		"mode": "json",
+		"list": ".products[]",
+		"result": {
+			"name": ".name",
+			"variants": {"list": ".variants[]", "result": {"sku": ".sku"}}
+		}
+	}`), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.NewReader(`{"products":[{"name":"Shirt","variants":[{"sku":"s1","x":1},{"sku":"s2"}]}]}`)
+	res, _, err := e.extractJSON(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(res)
+	if want := `[{"name":"Shirt","variants":[{"sku":"s1"},{"sku":"s2"}]}]`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestExecuteContextCanceled(t *testing.T) {
+	aborted := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer ts.Close()
+	e := &Endpoint{
+		URL:    ts.URL,
+		Result: map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := e.ExecuteContext(ctx, map[string]string{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request was not aborted")
+	}
+}
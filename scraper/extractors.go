@@ -65,7 +65,8 @@ func (ex Extractors) execute(s *goquery.Selection) string {
 func (ex *Extractors) UnmarshalJSON(data []byte) error {
 	//force array
 	if bytes.IndexRune(data, '[') != 0 {
-		data = append([]byte{'['}, append(data, ']')...)
+		//copy, since data is the caller's buffer
+		data = append(append([]byte{'['}, data...), ']')
 	}
 	//parse strings
 	strs := []string{}
@@ -307,6 +308,24 @@ var generators = []struct {
 			}, nil
 		},
 	},
+	//xpath generator: evaluates the XPath expression against each
+	//element of the current selection, and selects the matched elements.
+	//Attribute and function results (@href, count(td)) set the value.
+	{
+		match: func(extractor string) bool {
+			return strings.HasPrefix(extractor, "xpath:")
+		},
+		generate: func(extractor string) (extractorFn, error) {
+			exprStr := strings.TrimPrefix(extractor, "xpath:")
+			expr, err := compileXPath(exprStr, nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid xpath '%s': %s", exprStr, err)
+			}
+			return func(value string, sel *goquery.Selection) (string, *goquery.Selection) {
+				return xpathSelect(expr, value, sel)
+			}, nil
+		},
+	},
 }
 
 // unquoteJoinSep accepts a Go-quoted string ("\n", "|") or a bare separator.
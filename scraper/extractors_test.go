@@ -258,3 +258,33 @@ func TestExtractorChaining(t *testing.T) {
 		t.Errorf("got %q, want /x", got)
 	}
 }
+
+func TestXPathExtractor(t *testing.T) {
+	page := `<table>
+		<tr><th>Name</th><td class="v">Widget</td></tr>
+		<tr><th>Price</th><td class="v">$5</td><td class="n">each</td></tr>
+	</table>
+	<ul><li><a href="/a">A</a></li><li><a href="/b">B</a></li></ul>`
+	tests := []struct {
+		specs []string
+		want  string
+	}{
+		{[]string{"xpath://th[text()='Price']/following-sibling::td"}, "$5,each"},
+		{[]string{"xpath://th[text()='Price']/following-sibling::td", "first()", "@class"}, "v"},
+		{[]string{"xpath://th[text()='Price']/following-sibling::td", "/\\d+/"}, "5"},
+		{[]string{"li", "xpath:a/@href"}, "/a,/b"},
+		{[]string{"xpath://a", "join(|)"}, "A|B"},
+		{[]string{"xpath:count(//li)"}, "2"},
+		// relative to the css selection
+		{[]string{"tr:last-child", "xpath:th", "html()"}, "Price"},
+		{[]string{"xpath://missing"}, ""},
+	}
+	for _, tt := range tests {
+		if got := runChain(t, page, tt.specs...); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.specs, got, tt.want)
+		}
+	}
+	if _, err := NewExtractor("xpath://td["); err == nil {
+		t.Error("expected invalid xpath to be rejected")
+	}
+}
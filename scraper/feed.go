@@ -0,0 +1,319 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// feed namespaces
+const (
+	atomNS    = "http://www.w3.org/2005/Atom"
+	contentNS = "http://purl.org/rss/1.0/modules/content/"
+	dcNS      = "http://purl.org/dc/elements/1.1/"
+)
+
+// feedDates are the date formats found in feeds
+var feedDates = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// extractFeed extracts normalised items from an RSS, Atom or JSON Feed
+// response. Result fields are applied to each raw item, as XPath
+// selectors (or jq selectors for JSON Feeds), and replace or add to
+// the normalised fields.
+func (e *Endpoint) extractFeed(body io.Reader) ([]Result, string, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", err
+	}
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		return e.extractJSONFeed(t)
+	}
+	doc, err := xmlquery.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse feed: %w", err)
+	}
+	root := doc.SelectElement("*")
+	if root == nil {
+		return nil, "", errors.New("failed to parse feed: no root element")
+	}
+	var items []*xmlquery.Node
+	var normalise func(*xmlquery.Node) Result
+	switch {
+	case root.Data == "feed" && root.NamespaceURI == atomNS:
+		items = feedChildren(root, atomNS, "entry")
+		normalise = atomItem
+	case root.Data == "rss":
+		items = feedChildren(feedChild(root, "", "channel"), "", "item")
+		normalise = rssItem
+	case root.Data == "RDF":
+		// RSS 1.0 items are siblings of the channel
+		items = feedChildren(root, "*", "item")
+		normalise = rssItem
+	default:
+		return nil, "", fmt.Errorf("unknown feed format <%s> (expected RSS, Atom or JSON Feed)", root.Data)
+	}
+	if e.Debug {
+		logf("feed: %s => #%d items", root.Data, len(items))
+	}
+	results := make([]Result, 0, len(items))
+	for _, item := range items {
+		r := normalise(item)
+		extra, _ := e.extractXMLResult(e.Result, item)
+		for k, v := range extra {
+			r[k] = v
+		}
+		results = append(results, r)
+	}
+	next := ""
+	if p := e.Paginate; p != nil && len(p.Next) > 0 {
+		next = e.xpathExtract(p.Next, doc)
+	}
+	return results, next, nil
+}
+
+// extractJSONFeed extracts normalised items from a JSON Feed
+func (e *Endpoint) extractJSONFeed(b []byte) ([]Result, string, error) {
+	var data any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, "", fmt.Errorf("failed to parse JSON Feed: %w", err)
+	}
+	feed, _ := data.(map[string]any)
+	if v, _ := feed["version"].(string); !strings.Contains(v, "jsonfeed.org") {
+		return nil, "", errors.New("failed to parse feed: expected a JSON Feed version")
+	}
+	items, _ := feed["items"].([]any)
+	if e.Debug {
+		logf("feed: json => #%d items", len(items))
+	}
+	results := make([]Result, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		r := jsonFeedItem(m)
+		for k, v := range e.extractJSONResult(e.Result, item) {
+			r[k] = v
+		}
+		results = append(results, r)
+	}
+	next := ""
+	if p := e.Paginate; p != nil && len(p.Next) > 0 {
+		sel := jqPipeline(p.Next)
+		matches, err := runJQ(data, sel)
+		if err != nil {
+			return nil, "", fmt.Errorf("next selector %q: %w", sel, err)
+		}
+		if len(matches) > 0 {
+			next = jsonValueString(matches[0])
+		}
+	}
+	return results, next, nil
+}
+
+// rssItem normalises an RSS 2.0 (or 1.0) item
+func rssItem(n *xmlquery.Node) Result {
+	r := Result{}
+	setFeedField(r, "title", feedText(n, "", "title"))
+	setFeedField(r, "link", feedText(n, "", "link"))
+	id := feedText(n, "", "guid")
+	if id == "" {
+		id = feedText(n, "", "link")
+	}
+	if id == "" {
+		id = n.SelectAttr("rdf:about")
+	}
+	setFeedField(r, "id", id)
+	published := feedText(n, "", "pubDate")
+	if published == "" {
+		published = feedText(n, dcNS, "date")
+	}
+	setFeedField(r, "published", feedDate(published))
+	author := feedText(n, "", "author")
+	if author == "" {
+		author = feedText(n, dcNS, "creator")
+	}
+	setFeedField(r, "author", author)
+	setFeedField(r, "summary", feedText(n, "", "description"))
+	setFeedField(r, "content", feedText(n, contentNS, "encoded"))
+	categories := []string{}
+	for _, c := range feedChildren(n, "", "category") {
+		if s := strings.TrimSpace(c.InnerText()); s != "" {
+			categories = append(categories, s)
+		}
+	}
+	if len(categories) > 0 {
+		r["categories"] = categories
+	}
+	enclosures := []Result{}
+	for _, c := range feedChildren(n, "", "enclosure") {
+		enclosures = append(enclosures, enclosure(c.SelectAttr("url"), c.SelectAttr("type"), c.SelectAttr("length")))
+	}
+	if len(enclosures) > 0 {
+		r["enclosures"] = enclosures
+	}
+	return r
+}
+
+// atomItem normalises an Atom entry
+func atomItem(n *xmlquery.Node) Result {
+	r := Result{}
+	setFeedField(r, "title", feedText(n, atomNS, "title"))
+	enclosures := []Result{}
+	for _, l := range feedChildren(n, atomNS, "link") {
+		switch l.SelectAttr("rel") {
+		case "", "alternate":
+			if _, ok := r["link"]; !ok {
+				setFeedField(r, "link", l.SelectAttr("href"))
+			}
+		case "enclosure":
+			enclosures = append(enclosures, enclosure(l.SelectAttr("href"), l.SelectAttr("type"), l.SelectAttr("length")))
+		}
+	}
+	setFeedField(r, "id", feedText(n, atomNS, "id"))
+	setFeedField(r, "published", feedDate(feedText(n, atomNS, "published")))
+	setFeedField(r, "updated", feedDate(feedText(n, atomNS, "updated")))
+	if a := feedChild(n, atomNS, "author"); a != nil {
+		setFeedField(r, "author", feedText(a, atomNS, "name"))
+	}
+	setFeedField(r, "summary", feedText(n, atomNS, "summary"))
+	setFeedField(r, "content", feedText(n, atomNS, "content"))
+	categories := []string{}
+	for _, c := range feedChildren(n, atomNS, "category") {
+		if s := c.SelectAttr("term"); s != "" {
+			categories = append(categories, s)
+		}
+	}
+	if len(categories) > 0 {
+		r["categories"] = categories
+	}
+	if len(enclosures) > 0 {
+		r["enclosures"] = enclosures
+	}
+	return r
+}
+
+// jsonFeedItem normalises a JSON Feed item
+func jsonFeedItem(m map[string]any) Result {
+	r := Result{}
+	str := func(m map[string]any, k string) string {
+		s, _ := m[k].(string)
+		return s
+	}
+	setFeedField(r, "title", str(m, "title"))
+	setFeedField(r, "link", str(m, "url"))
+	setFeedField(r, "id", jsonValueString(m["id"]))
+	setFeedField(r, "published", feedDate(str(m, "date_published")))
+	setFeedField(r, "updated", feedDate(str(m, "date_modified")))
+	author, _ := m["author"].(map[string]any)
+	if authors, _ := m["authors"].([]any); len(authors) > 0 {
+		author, _ = authors[0].(map[string]any)
+	}
+	if author != nil {
+		setFeedField(r, "author", str(author, "name"))
+	}
+	setFeedField(r, "summary", str(m, "summary"))
+	content := str(m, "content_html")
+	if content == "" {
+		content = str(m, "content_text")
+	}
+	setFeedField(r, "content", content)
+	if tags, _ := m["tags"].([]any); len(tags) > 0 {
+		categories := []string{}
+		for _, t := range tags {
+			if s, ok := t.(string); ok {
+				categories = append(categories, s)
+			}
+		}
+		r["categories"] = categories
+	}
+	if attachments, _ := m["attachments"].([]any); len(attachments) > 0 {
+		enclosures := []Result{}
+		for _, a := range attachments {
+			if a, ok := a.(map[string]any); ok {
+				enclosures = append(enclosures, enclosure(str(a, "url"), str(a, "mime_type"), jsonValueString(a["size_in_bytes"])))
+			}
+		}
+		r["enclosures"] = enclosures
+	}
+	return r
+}
+
+// enclosure is a normalised enclosure
+func enclosure(url, typ, length string) Result {
+	r := Result{}
+	setFeedField(r, "url", url)
+	setFeedField(r, "type", typ)
+	if n, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64); err == nil && n > 0 {
+		r["length"] = n
+	}
+	return r
+}
+
+// feedChild returns the first child element with the name, in
+// namespace ns ("" for none, "*" for any), nil-safe
+func feedChild(n *xmlquery.Node, ns, name string) *xmlquery.Node {
+	if c := feedChildren(n, ns, name); len(c) > 0 {
+		return c[0]
+	}
+	return nil
+}
+
+// feedChildren returns the child elements with the name,
+// in namespace ns ("" for none, "*" for any), nil-safe
+func feedChildren(n *xmlquery.Node, ns, name string) []*xmlquery.Node {
+	var nodes []*xmlquery.Node
+	if n == nil {
+		return nodes
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == xmlquery.ElementNode && c.Data == name && (ns == "*" || c.NamespaceURI == ns || ns == "" && c.Prefix == "") {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// feedText returns the trimmed text of the first matching child
+func feedText(n *xmlquery.Node, ns, name string) string {
+	if c := feedChild(n, ns, name); c != nil {
+		return strings.TrimSpace(c.InnerText())
+	}
+	return ""
+}
+
+// feedDate converts a feed date to RFC 3339, or returns it as-is
+// when its format is unknown
+func feedDate(s string) string {
+	for _, layout := range feedDates {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+// setFeedField sets non-empty values
+func setFeedField(r Result, k, v string) {
+	if v != "" {
+		r[k] = v
+	}
+}
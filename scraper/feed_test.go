@@ -0,0 +1,167 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const rssFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel>
+    <title>Blog</title>
+    <item>
+      <title>Hello</title>
+      <link>https://example.com/hello</link>
+      <guid isPermaLink="false">post-1</guid>
+      <pubDate>Tue, 10 Jun 2025 04:00:00 GMT</pubDate>
+      <dc:creator>Ann</dc:creator>
+      <description>Short</description>
+      <content:encoded><![CDATA[<p>Long</p>]]></content:encoded>
+      <category>go</category>
+      <category>web</category>
+      <enclosure url="https://example.com/a.mp3" type="audio/mpeg" length="123"/>
+      <comments>https://example.com/hello#comments</comments>
+    </item>
+  </channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Blog</title>
+  <entry>
+    <title>Hello</title>
+    <link rel="enclosure" href="https://example.com/a.mp3" type="audio/mpeg" length="123"/>
+    <link href="https://example.com/hello"/>
+    <id>urn:post-1</id>
+    <published>2025-06-10T04:00:00Z</published>
+    <updated>2025-06-11T04:00:00Z</updated>
+    <author><name>Ann</name></author>
+    <summary>Short</summary>
+    <content type="html">&lt;p&gt;Long&lt;/p&gt;</content>
+    <category term="go"/>
+  </entry>
+</feed>`
+
+const jsonFeed = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Blog",
+  "items": [{
+    "id": "1",
+    "url": "https://example.com/hello",
+    "title": "Hello",
+    "content_html": "<p>Long</p>",
+    "date_published": "2025-06-10T04:00:00Z",
+    "authors": [{"name": "Ann"}],
+    "tags": ["go"],
+    "attachments": [{"url": "https://example.com/a.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 123}],
+    "_views": 7
+  }]
+}`
+
+const rdfFeed = `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://example.com/"><title>Blog</title></channel>
+  <item rdf:about="https://example.com/hello">
+    <title>Hello</title>
+    <link>https://example.com/hello</link>
+    <dc:date>2025-06-10T04:00:00Z</dc:date>
+  </item>
+</rdf:RDF>`
+
+func TestExtractFeed(t *testing.T) {
+	for name, tt := range map[string]struct {
+		body   string
+		result map[string]Field
+		want   string
+	}{
+		"rss": {
+			rssFeed,
+			map[string]Field{"comments": {Extract: mustExtractors(t, "comments")}},
+			`{"author":"Ann","categories":["go","web"],"comments":"https://example.com/hello#comments","content":"\u003cp\u003eLong\u003c/p\u003e","enclosures":[{"length":123,"type":"audio/mpeg","url":"https://example.com/a.mp3"}],"id":"post-1","link":"https://example.com/hello","published":"2025-06-10T04:00:00Z","summary":"Short","title":"Hello"}`,
+		},
+		"atom": {
+			atomFeed,
+			map[string]Field{"title": {Extract: mustExtractors(t, "title", "s/Hello/Hi/")}},
+			`{"author":"Ann","categories":["go"],"content":"\u003cp\u003eLong\u003c/p\u003e","enclosures":[{"length":123,"type":"audio/mpeg","url":"https://example.com/a.mp3"}],"id":"urn:post-1","link":"https://example.com/hello","published":"2025-06-10T04:00:00Z","summary":"Short","title":"Hi","updated":"2025-06-11T04:00:00Z"}`,
+		},
+		"json": {
+			jsonFeed,
+			map[string]Field{"views": {Extract: mustExtractors(t, "._views")}},
+			`{"author":"Ann","categories":["go"],"content":"\u003cp\u003eLong\u003c/p\u003e","enclosures":[{"length":123,"type":"audio/mpeg","url":"https://example.com/a.mp3"}],"id":"1","link":"https://example.com/hello","published":"2025-06-10T04:00:00Z","title":"Hello","views":7}`,
+		},
+		"rdf": {
+			rdfFeed,
+			nil,
+			`{"id":"https://example.com/hello","link":"https://example.com/hello","published":"2025-06-10T04:00:00Z","title":"Hello"}`,
+		},
+	} {
+		e := &Endpoint{Mode: "feed", Result: tt.result}
+		res, _, err := e.extractFeed(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(res) != 1 {
+			t.Fatalf("%s: expected 1 item, got %v", name, res)
+		}
+		if b, _ := json.Marshal(res[0]); string(b) != tt.want {
+			t.Errorf("%s:\nexpected %s\n     got %s", name, tt.want, b)
+		}
+	}
+}
+
+func TestExtractFeedUnknown(t *testing.T) {
+	e := &Endpoint{Mode: "feed"}
+	for _, body := range []string{`<html><body></body></html>`, `{"items": []}`, `not a feed`} {
+		if _, _, err := e.extractFeed(strings.NewReader(body)); err == nil {
+			t.Errorf("%s: expected an error", body)
+		}
+	}
+}
+
+func TestFeedFollow(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed" {
+			w.Write([]byte(strings.ReplaceAll(rssFeed, "https://example.com", ts.URL)))
+			return
+		}
+		w.Write([]byte(`<article>Full text</article>`))
+	}))
+	defer ts.Close()
+	e := &Endpoint{
+		Mode: "feed",
+		URL:  ts.URL + "/feed",
+		Result: map[string]Field{
+			"article": {Follow: mustExtractors(t, "link"), Result: map[string]Field{"text": {Extract: mustExtractors(t, "article")}}},
+		},
+		Scraper: &Scraper{Transport: http.DefaultTransport},
+	}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := res[0]["article"].(Result); a["text"] != "Full text" || res[0]["title"] != "Hello" {
+		t.Fatalf("expected the followed article, got %v", res)
+	}
+}
+
+func TestFeedHandlerOneItem(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rssFeed))
+	}))
+	defer ts.Close()
+	h := &Handler{}
+	if err := h.LoadConfig([]byte(`{"/f": {"mode": "feed", "url": "` + ts.URL + `"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/f", nil))
+	// a feed is an array, whatever its number of items
+	var res []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res) != 1 || res[0]["title"] != "Hello" {
+		t.Fatalf("expected an array of one item, got %d %s", rec.Code, rec.Body)
+	}
+}
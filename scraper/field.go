@@ -0,0 +1,184 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// field types
+const (
+	typeString = "string"
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+	typeArray  = "array"
+	typeObject = "object"
+	typeRaw    = "raw"
+)
+
+// Field describes how a single result field is extracted. In JSON
+// config a field is usually an extractor or a list of extractors,
+// but may also be an object which sets the type of the value,
+// which applies a nested result map relative to the current context
+// (optionally split by a list selector), or which follows a link to
+// a detail page and applies a nested result map to it:
+//
+//	"price": {"extract": ".price", "type": "float"}
+//	"variants": {"list": ".variant", "result": {"name": ".name"}}
+//	"detail": {"follow": ["a", "@href"], "result": {"price": ".price"}}
+type Field struct {
+	// Extract is the extractor pipeline for this field
+	Extract Extractors `json:"extract,omitempty"`
+	// Type converts the extracted value to a JSON type. One of
+	// string, int, float, bool, array, object or raw. Raw values
+	// must be JSON text, which is embedded as-is.
+	Type string `json:"type,omitempty"`
+	// Follow extracts the URL of a detail page
+	Follow Extractors `json:"follow,omitempty"`
+	// List splits the current context into a list of nested results
+	List string `json:"list,omitempty"`
+	// Result is applied to the current context, each list item,
+	// or the followed detail page
+	Result map[string]Field `json:"result,omitempty"`
+	// Concurrency bounds parallel detail page fetches (defaults to 4)
+	Concurrency int `json:"concurrency,omitempty"`
+	// optional fields don't exclude list items when missing,
+	// such as those of pointer struct fields
+	optional bool
+}
+
+func (f *Field) UnmarshalJSON(data []byte) error {
+	//extractor string or list
+	if d := bytes.TrimSpace(data); len(d) == 0 || d[0] != '{' {
+		*f = Field{}
+		return f.Extract.UnmarshalJSON(data)
+	}
+	type field Field
+	if err := json.Unmarshal(data, (*field)(f)); err != nil {
+		return err
+	}
+	return f.validate()
+}
+
+func (f Field) MarshalJSON() ([]byte, error) {
+	if f.simple() {
+		return f.Extract.MarshalJSON()
+	}
+	type field Field
+	return json.Marshal(field(f))
+}
+
+func (f *Field) validate() error {
+	switch f.Type {
+	case "", typeString, typeInt, typeFloat, typeBool, typeArray, typeObject, typeRaw:
+	default:
+		return fmt.Errorf("unknown field type %q", f.Type)
+	}
+	switch {
+	case len(f.Follow) > 0 && len(f.Extract) > 0:
+		return errors.New("field cannot have both extract and follow")
+	case len(f.Follow) > 0 && len(f.Result) == 0:
+		return errors.New("field with follow expects a result")
+	case len(f.Follow) > 0 && f.List != "":
+		return errors.New("field cannot have both follow and list")
+	case len(f.Extract) > 0 && len(f.Result) > 0:
+		return errors.New("field cannot have both extract and result")
+	case f.List != "" && len(f.Result) == 0:
+		return errors.New("field with list expects a result")
+	case f.Type != "" && len(f.Result) > 0:
+		return errors.New("field with result cannot have a type")
+	case len(f.Follow) == 0 && len(f.Extract) == 0 && len(f.Result) == 0:
+		return errors.New("field expects extract, result or follow")
+	}
+	return nil
+}
+
+// nested reports whether the field is a nested object or list
+// extracted from the current context
+func (f Field) nested() bool {
+	return len(f.Result) > 0 && len(f.Follow) == 0
+}
+
+// simple reports whether the field is just an extractor pipeline
+func (f Field) simple() bool {
+	return len(f.Follow) == 0 && len(f.Result) == 0 && f.Type == "" && f.Concurrency == 0
+}
+
+// convert converts an extracted value to the field type. HTML mode
+// values are always strings, whereas JSON mode values are passed
+// through untouched when no type is set.
+func (f Field) convert(v any) (any, error) {
+	s, isString := v.(string)
+	switch f.Type {
+	case "":
+		return v, nil
+	case typeString:
+		return jsonValueString(v), nil
+	case typeInt:
+		if n, ok := v.(float64); ok && n == float64(int64(n)) {
+			return int64(n), nil
+		}
+		return strconv.ParseInt(strings.TrimSpace(jsonValueString(v)), 10, 64)
+	case typeFloat:
+		if n, ok := v.(float64); ok {
+			return n, nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(jsonValueString(v)), 64)
+	case typeBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(jsonValueString(v)))
+	case typeArray:
+		if a, ok := v.([]any); ok {
+			return a, nil
+		}
+		if !isString {
+			return nil, fmt.Errorf("expected array, got %T", v)
+		}
+		//json array, or multiple comma-joined matches
+		a := []any{}
+		if err := json.Unmarshal([]byte(s), &a); err == nil {
+			return a, nil
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			for _, item := range strings.Split(s, ",") {
+				a = append(a, strings.TrimSpace(item))
+			}
+		}
+		return a, nil
+	case typeObject:
+		if o, ok := v.(map[string]any); ok {
+			return o, nil
+		}
+		o := map[string]any{}
+		if !isString {
+			return nil, fmt.Errorf("expected object, got %T", v)
+		}
+		if err := json.Unmarshal([]byte(s), &o); err != nil {
+			return nil, err
+		}
+		return o, nil
+	case typeRaw:
+		if !isString {
+			return v, nil
+		}
+		if !json.Valid([]byte(s)) {
+			return nil, errors.New("invalid JSON")
+		}
+		return json.RawMessage(s), nil
+	}
+	return nil, fmt.Errorf("unknown field type %q", f.Type)
+}
+
+// required reports whether a list item without a value for the field
+// is excluded. Follow fields aren't, since a failed detail fetch leaves
+// them empty, nor are optional fields. Values which fail to convert
+// are left out of the result, but still count as found.
+func (f Field) required() bool {
+	return len(f.Follow) == 0 && !f.optional
+}
@@ -0,0 +1,93 @@
+package scraper
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFieldJSON(t *testing.T) {
+	for _, input := range []string{
+		`"h1"`,
+		`["a","@href"]`,
+		`{"follow":["a","@href"],"result":{"price":[".price"]}}`,
+		`{"list":".variant","result":{"name":[".name"]}}`,
+	} {
+		f := Field{}
+		if err := json.Unmarshal([]byte(input), &f); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		b, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := input
+		if input == `"h1"` {
+			want = `["h1"]`
+		}
+		if string(b) != want {
+			t.Errorf("got %s, want %s", b, want)
+		}
+	}
+	for input, want := range map[string]string{
+		`{}`:                                 "expects extract, result or follow",
+		`{"follow":"a"}`:                     "expects a result",
+		`{"list":"li"}`:                      "expects a result",
+		`{"extract":"a","result":{"a":"b"}}`: "both extract and result",
+		`{"type":"int","result":{"a":"b"}}`:  "cannot have a type",
+		`{"follow":"a","list":"li","result":{"a":"b"}}`: "both follow and list",
+		`{"extract":"a","follow":"a"}`:                  "both extract and follow",
+		`{"extract":"a","type":"date"}`:                 "unknown field type",
+	} {
+		f := Field{}
+		err := json.Unmarshal([]byte(input), &f)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want error containing %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestFieldConvert(t *testing.T) {
+	tests := []struct {
+		typ     string
+		in      any
+		want    any
+		wantErr bool
+	}{
+		{"", "42", "42", false},
+		{"", 42.0, 42.0, false},
+		{"string", 42.0, "42", false},
+		{"string", []any{1.0}, "[1]", false},
+		{"int", " 42 ", int64(42), false},
+		{"int", 42.0, int64(42), false},
+		{"int", "4.2", nil, true},
+		{"float", "4.2", 4.2, false},
+		{"float", 4.2, 4.2, false},
+		{"bool", "true", true, false},
+		{"bool", false, false, false},
+		{"bool", "yes", nil, true},
+		{"array", "a, b,c", []any{"a", "b", "c"}, false},
+		{"array", `[1,"x"]`, []any{1.0, "x"}, false},
+		{"array", "", []any{}, false},
+		{"array", 1.0, nil, true},
+		{"object", `{"k":"v"}`, map[string]any{"k": "v"}, false},
+		{"object", "nope", nil, true},
+		{"raw", `{"k":[1,2]}`, json.RawMessage(`{"k":[1,2]}`), false},
+		{"raw", `{bad`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Field{Type: tt.typ}.convert(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s(%v): want error, got %v", tt.typ, tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s(%v): %v", tt.typ, tt.in, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s(%v) = %#v, want %#v", tt.typ, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/xmlquery"
+)
+
+// defaultFollowConcurrency bounds parallel detail page fetches
+const defaultFollowConcurrency = 4
+
+// follow fetches the detail page linked from each result for every
+// follow field, replacing the extracted link with the nested result
+// of the detail page. A failed fetch leaves the field empty instead
+// of failing the whole request. Follow fields within nested results
+// and detail pages are followed too, sharing a single limit of
+// parallel fetches: the largest concurrency of the follow fields.
+func (e *Endpoint) follow(ctx context.Context, fields map[string]Field, results []Result, base *url.URL) {
+	n := followConcurrency(fields)
+	if n == 0 {
+		return
+	}
+	e.followWith(ctx, make(chan struct{}, n), fields, results, base)
+}
+
+// followWith follows the fields of results, fetching
+// a detail page while holding a slot of sem
+func (e *Endpoint) followWith(ctx context.Context, sem chan struct{}, fields map[string]Field, results []Result, base *url.URL) {
+	for name, f := range fields {
+		if f.nested() {
+			e.followWith(ctx, sem, f.Result, nestedResults(results, name), base)
+			continue
+		}
+		if len(f.Follow) == 0 {
+			continue
+		}
+		wg := sync.WaitGroup{}
+	items:
+		for _, r := range results {
+			link, ok := r[name].(string)
+			if !ok {
+				continue
+			}
+			link = resolveURL(base, link)
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				break items
+			}
+			wg.Add(1)
+			go func(r Result) {
+				defer wg.Done()
+				detail, u, err := e.fetchDetail(ctx, f.Result, link)
+				// the slot is released before following the detail
+				// page's own links, which wait for slots of their own
+				<-sem
+				if err != nil {
+					delete(r, name)
+					if e.Debug {
+						logf("follow %s: %s: %s", name, link, err)
+					}
+					return
+				}
+				e.followWith(ctx, sem, f.Result, []Result{detail}, u)
+				r[name] = detail
+			}(r)
+		}
+		wg.Wait()
+	}
+}
+
+// followConcurrency returns the largest concurrency of the
+// follow fields, at any depth, or 0 when there are none
+func followConcurrency(fields map[string]Field) int {
+	n := 0
+	for _, f := range fields {
+		if len(f.Follow) > 0 {
+			c := f.Concurrency
+			if c <= 0 {
+				c = defaultFollowConcurrency
+			}
+			n = max(n, c)
+		}
+		n = max(n, followConcurrency(f.Result))
+	}
+	return n
+}
+
+// nestedResults collects the nested results of field name
+func nestedResults(results []Result, name string) []Result {
+	var nested []Result
+	for _, r := range results {
+		switch v := r[name].(type) {
+		case Result:
+			nested = append(nested, v)
+		case []Result:
+			nested = append(nested, v...)
+		}
+	}
+	return nested
+}
+
+// fetchDetail fetches a followed page and extracts fields from it,
+// returning the page's URL to resolve its own links against
+func (e *Endpoint) fetchDetail(ctx context.Context, fields map[string]Field, link string) (Result, *url.URL, error) {
+	resp, err := e.fetch(ctx, http.MethodGet, link, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	var r Result
+	switch mode := e.mode(); mode {
+	case "html", "feed", "csv", "table":
+		// feeds, csv files and tables link to html pages
+		doc, err := goquery.NewDocumentFromReader(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		r, _ = e.extract(fields, doc.Selection)
+	case "json":
+		var data any
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		r = e.extractJSONResult(fields, data)
+	case "xml":
+		doc, err := xmlquery.Parse(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse XML: %w", err)
+		}
+		r, _ = e.extractXMLResult(fields, doc)
+	default:
+		return nil, nil, fmt.Errorf("unknown mode %q", mode)
+	}
+	return r, resp.URL, nil
+}
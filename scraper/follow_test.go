@@ -0,0 +1,127 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list":
+			fmt.Fprint(w, `
+				<div class="item"><h2>One</h2><a href="/item/1">x</a></div>
+				<div class="item"><h2>Two</h2><a href="item/2">x</a></div>
+				<div class="item"><h2>Broken</h2><a href="http://127.0.0.1:1/">x</a></div>
+				<div class="item"><h2>No link</h2></div>
+			`)
+		default:
+			fmt.Fprintf(w, `<span class="price">$%s</span>`, strings.TrimPrefix(r.URL.Path, "/item/"))
+		}
+	}))
+	defer ts.Close()
+	var config Config
+	err := json.Unmarshal([]byte(`{"list": {
+		"url": "`+ts.URL+`/list",
+		"list": ".item",
+		"result": {
+			"name": "h2",
+			"detail": {
+				"follow": ["a", "@href"],
+				"concurrency": 2,
+				"result": {"price": ".price"}
+			}
+		}
+	}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := config["list"].Execute(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 {
+		t.Fatalf("got %d results, want 4: %v", len(res), res)
+	}
+	if d, _ := res[0]["detail"].(Result); d["price"] != "$1" {
+		t.Errorf("result[0] = %v", res[0])
+	}
+	if d, _ := res[1]["detail"].(Result); d["price"] != "$2" {
+		t.Errorf("result[1] = %v", res[1])
+	}
+	for _, r := range res[2:] {
+		if len(r) != 1 || r["name"] == "" {
+			t.Errorf("want only name, got %v", r)
+		}
+	}
+}
+
+func TestFollowConcurrencyShared(t *testing.T) {
+	var inflight, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/list" {
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// every page links to 3 pages of the next level
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, `<div class="item"><a href="%s/%d">x</a></div>`, r.URL.Path, i)
+		}
+	}))
+	defer ts.Close()
+	var config Config
+	err := json.Unmarshal([]byte(`{"list": {
+		"url": "`+ts.URL+`/list",
+		"list": ".item",
+		"result": {
+			"a": {"follow": ["a", "@href"], "concurrency": 2, "result": {
+				"b": {"list": ".item", "result": {
+					"link": {"follow": ["a", "@href"], "concurrency": 2, "result": {
+						"c": {"list": ".item", "result": {
+							"link": {"follow": ["a", "@href"], "concurrency": 2, "result": {"n": "a"}}
+						}}
+					}}
+				}}
+			}}
+		}
+	}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := config["list"]
+	e.Scraper = &Scraper{Transport: http.DefaultTransport}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := res[2]["a"].(Result)
+	b, _ := a["b"].([]Result)
+	if len(b) != 3 {
+		t.Fatalf("expected 3 nested results, got %v", res[2])
+	}
+	link, _ := b[2]["link"].(Result)
+	c, _ := link["c"].([]Result)
+	if len(c) != 3 {
+		t.Fatalf("expected 3 nested results, got %v", link)
+	}
+	if d, _ := c[2]["link"].(Result); d["n"] != "x,x,x" {
+		t.Fatalf("expected 3 levels of follows, got %v", c[2])
+	}
+	// nested levels share the limit, rather than 2 for each fetch
+	if peak > 2 {
+		t.Fatalf("expected at most 2 fetches at once, got %d", peak)
+	}
+}
@@ -1,17 +1,61 @@
 package scraper
 
 import (
+	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
+var (
+	//ErrNoResult is returned by Execute when a single Result
+	//struct is given, though no result was found
+	ErrNoResult = errors.New("no result found")
+	//ErrMultipleResults is returned by Execute when a single
+	//Result struct is given, though many results were found
+	ErrMultipleResults = errors.New("expected 1 result, found many")
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+//FieldError is returned by Execute when a result
+//value cannot be set onto its struct field
+type FieldError struct {
+	Field string
+	Value interface{}
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("result field %s: %s", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
 //Execute builds an Endpoint with Extractors using the given
 //struct and executes it
 func Execute(gostruct interface{}) error {
+	return ExecuteContext(context.Background(), gostruct)
+}
+
+//ExecuteContext is Execute with a context. Upstream requests are
+//aborted when ctx is done, in which case ctx.Err() is returned.
+func ExecuteContext(ctx context.Context, gostruct interface{}) error {
+	return executeStruct(ctx, DefaultScraper, gostruct)
+}
+
+func executeStruct(ctx context.Context, s *Scraper, gostruct interface{}) error {
 	//must be struct pointer
 	v := reflect.ValueOf(gostruct)
 	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
@@ -23,12 +67,13 @@ func Execute(gostruct interface{}) error {
 	if err != nil {
 		return err
 	}
+	endpoint.Scraper = s
 	if endpoint.Debug {
 		j, _ := json.MarshalIndent(endpoint, "", "  ")
 		logf("computed endpoint: %s", j)
 	}
 	params := newParamsFromStruct(v)
-	results, err := endpoint.Execute(params)
+	results, err := endpoint.ExecuteContext(ctx, params)
 	if err != nil {
 		return err
 	}
@@ -119,39 +164,80 @@ func parseListExtractors(v reflect.Value, e *Endpoint) error {
 		return errors.New("expected Result struct or []struct")
 	}
 	rt := r.Type
+	//extract list selector, optional for a single struct
+	e.List = r.Tag.Get("scraper")
 	if rt.Kind() == reflect.Slice {
-		//extract list selector
-		l := r.Tag.Get("scraper")
-		if l == "" {
+		if e.List == "" {
 			return errors.New("expected slice field to have list selector")
 		}
-		e.List = l
 		//elem is extractor set
 		rt = rt.Elem()
 	}
 	if rt.Kind() != reflect.Struct {
 		return errors.New("expected Result struct or []struct")
 	}
-	//result list struct fields are extractors
-	extractors := map[string]Extractors{}
+	fields, err := parseFields(rt)
+	if err != nil {
+		return err
+	}
+	e.Result = fields
+	return nil
+}
+
+//parseFields converts result struct fields into extractors.
+//Nested struct fields become nested results, and []struct
+//fields become nested lists using their tag as the list selector.
+func parseFields(rt reflect.Type) (map[string]Field, error) {
+	fields := map[string]Field{}
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
 		s := f.Tag.Get("scraper")
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		list := ft.Kind() == reflect.Slice && isNested(ft.Elem())
+		if list || isNested(ft) {
+			if list && s == "" {
+				return nil, fmt.Errorf("expected result field %s to have list selector (scraper struct tag)", f.Name)
+			}
+			if list {
+				ft = ft.Elem()
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+			}
+			nested, err := parseFields(ft)
+			if err != nil {
+				return nil, fmt.Errorf("result field %s: %s", f.Name, err)
+			}
+			fields[f.Name] = Field{List: s, Result: nested}
+			continue
+		}
 		if s == "" {
-			return fmt.Errorf("expected result field %s to have selector (scraper struct tag)", f.Name)
+			return nil, fmt.Errorf("expected result field %s to have selector (scraper struct tag)", f.Name)
 		}
 		es := Extractors{}
 		for _, sel := range strings.Split(s, " | ") {
 			e, err := NewExtractor(sel)
 			if err != nil {
-				return fmt.Errorf("result field %s: %s: %s", f.Name, sel, err)
+				return nil, fmt.Errorf("result field %s: %s: %s", f.Name, sel, err)
 			}
 			es = append(es, e)
 		}
-		extractors[f.Name] = es
+		//pointers are left nil when the value is missing
+		fields[f.Name] = Field{Extract: es, optional: f.Type.Kind() == reflect.Ptr}
 	}
-	e.Result = extractors
-	return nil
+	return fields, nil
+}
+
+//isNested reports whether t is a nested result struct,
+//as opposed to a value type such as time.Time
+func isNested(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
 }
 
 func newParamsFromStruct(v reflect.Value) map[string]string {
@@ -180,7 +266,7 @@ func setResultsToStruct(results []Result, v reflect.Value) error {
 	t := v.Type()
 	r, ok := t.FieldByName("Result")
 	if !ok {
-		panic("expected Result struct or []struct")
+		return errors.New("expected Result struct or []struct")
 	}
 	st := r.Type
 	//single struct?
@@ -192,22 +278,201 @@ func setResultsToStruct(results []Result, v reflect.Value) error {
 	//take type of given struct
 	et := st.Elem()
 	//loop results
+	var errs []error
 	for i, kvs := range results {
 		//create new struct per result
 		ev := reflect.New(et).Elem()
-		//set each kv
-		for k, v := range kvs {
-			evf := ev.FieldByName(k)
-			evf.Set(reflect.ValueOf(v))
+		if err := setResult(kvs, ev); err != nil {
+			errs = append(errs, fmt.Errorf("result #%d: %w", i+1, err))
 		}
 		//add new struct to new slice
 		sv.Index(i).Set(ev)
 	}
+	//leave Result untouched on failure
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
 	//set results onto original gostruct
 	v.FieldByName("Result").Set(sv)
 	return nil
 }
 
+//setResult sets each kv of a result onto a struct. Every
+//field which cannot be set is reported as a *FieldError.
+func setResult(r Result, ev reflect.Value) error {
+	var errs []error
+	for k, v := range r {
+		sf, ok := ev.Type().FieldByName(k)
+		f := ev.FieldByName(k)
+		if !ok || !f.CanSet() {
+			errs = append(errs, &FieldError{Field: k, Value: v, Err: fmt.Errorf("no matching struct field in %s", ev.Type())})
+			continue
+		}
+		if err := setField(f, sf.Tag, v); err != nil {
+			errs = append(errs, &FieldError{Field: k, Value: v, Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//setField sets a result value onto a struct field, converting
+//extracted strings into the field's type. Pointer fields are
+//only allocated when a value is present. The "layout" struct
+//tag sets the time.Time layout (defaults to RFC3339) and the
+//"sep" struct tag sets the slice separator (defaults to ",").
+func setField(f reflect.Value, tag reflect.StructTag, v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		pv := reflect.New(f.Type().Elem())
+		if err := setField(pv.Elem(), tag, v); err != nil {
+			return err
+		}
+		f.Set(pv)
+		return nil
+	}
+	switch x := v.(type) {
+	case Result:
+		if !isNested(f.Type()) {
+			return fmt.Errorf("cannot set object to %s", f.Type())
+		}
+		return setResult(x, f)
+	case []Result:
+		if f.Kind() != reflect.Slice || !isNested(f.Type().Elem()) {
+			return fmt.Errorf("cannot set list to %s", f.Type())
+		}
+		sv := reflect.MakeSlice(f.Type(), len(x), len(x))
+		for i, r := range x {
+			if err := setField(sv.Index(i), "", r); err != nil {
+				return err
+			}
+		}
+		f.Set(sv)
+		return nil
+	case []interface{}:
+		if f.Kind() != reflect.Slice {
+			break
+		}
+		sv := reflect.MakeSlice(f.Type(), len(x), len(x))
+		for i, item := range x {
+			if err := setField(sv.Index(i), tag, item); err != nil {
+				return err
+			}
+		}
+		f.Set(sv)
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Type().AssignableTo(f.Type()) {
+		f.Set(rv)
+		return nil
+	}
+	return setString(f, tag, jsonValueString(v))
+}
+
+//setString parses s into the field's type
+func setString(f reflect.Value, tag reflect.StructTag, s string) error {
+	if f.Type() == timeType {
+		layout := tag.Get("layout")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if f.CanAddr() && f.Addr().Type().Implements(textUnmarshalerType) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	t := strings.TrimSpace(s)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(t)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(t, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(t, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(t, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		sep := tag.Get("sep")
+		if sep == "" {
+			sep = ","
+		}
+		var parts []string
+		if t != "" {
+			parts = strings.Split(s, sep)
+		}
+		sv := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setString(sv.Index(i), tag, strings.TrimSpace(p)); err != nil {
+				return fmt.Errorf("item #%d: %w", i+1, err)
+			}
+		}
+		f.Set(sv)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
+
+//setResultToStruct sets the one and only result onto
+//a single Result struct. Without a list selector, a page
+//always has one result, which is empty when nothing matched.
 func setResultToStruct(results []Result, v reflect.Value) error {
-	return errors.New("only list implemented")
+	switch n := len(results); {
+	case n == 0 || n == 1 && emptyResult(results[0]):
+		return ErrNoResult
+	case n > 1:
+		return fmt.Errorf("%w (got %d)", ErrMultipleResults, n)
+	}
+	//build into a new struct so a failure leaves Result untouched
+	rv := v.FieldByName("Result")
+	ev := reflect.New(rv.Type()).Elem()
+	if err := setResult(results[0], ev); err != nil {
+		return err
+	}
+	rv.Set(ev)
+	return nil
+}
+
+//emptyResult reports whether r has no values, other
+//than empty nested results
+func emptyResult(r Result) bool {
+	for _, v := range r {
+		switch x := v.(type) {
+		case Result:
+			if !emptyResult(x) {
+				return false
+			}
+		case []Result:
+			if len(x) > 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
 }
@@ -1,8 +1,15 @@
 package scraper
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestExecuteRejectsNonPointer(t *testing.T) {
@@ -31,3 +38,234 @@ func TestExecuteRejectsNilString(t *testing.T) {
 	}()
 	_ = Execute(s) // should return an error, not panic
 }
+
+func TestExecuteNestedStructs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `
+			<div class="product">
+				<h2>Shirt</h2><a class="brand" href="/acme">Acme</a>
+				<li class="variant"><b>S</b></li>
+				<li class="variant"><b>M</b></li>
+			</div>
+		`)
+	}))
+	defer ts.Close()
+	type variant struct {
+		Name string `scraper:"b"`
+	}
+	type brand struct {
+		Name string `scraper:".brand"`
+		URL  string `scraper:".brand | @href"`
+	}
+	type product struct {
+		Name     string `scraper:"h2"`
+		Brand    brand
+		Variants []variant `scraper:".variant"`
+	}
+	type endpoint struct {
+		URL    string
+		Result []product `scraper:".product"`
+	}
+	e := endpoint{URL: ts.URL}
+	if err := Execute(&e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Result) != 1 {
+		t.Fatalf("got %d results, want 1", len(e.Result))
+	}
+	p := e.Result[0]
+	if p.Name != "Shirt" || p.Brand.Name != "Acme" || p.Brand.URL != "/acme" {
+		t.Errorf("got %+v", p)
+	}
+	if len(p.Variants) != 2 || p.Variants[1].Name != "M" {
+		t.Errorf("got variants %+v", p.Variants)
+	}
+}
+
+func TestExecuteNestedSliceRequiresSelector(t *testing.T) {
+	type variant struct {
+		Name string `scraper:"b"`
+	}
+	type product struct {
+		Variants []variant
+	}
+	type endpoint struct {
+		URL    string
+		Result []product `scraper:".product"`
+	}
+	err := Execute(&endpoint{URL: "http://example.invalid"})
+	if err == nil || !strings.Contains(err.Error(), "list selector") {
+		t.Fatalf("want list selector error, got %v", err)
+	}
+}
+
+func TestExecuteSingleStruct(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<h1>Product %s</h1><span class="price">$10</span>`, r.URL.Query().Get("id"))
+	}))
+	defer ts.Close()
+	type product struct {
+		Name  string `scraper:"h1"`
+		Price string `scraper:".price"`
+	}
+	type endpoint struct {
+		URL    string
+		ID     string `scraper:"id"`
+		Result product
+	}
+	e := endpoint{URL: ts.URL + "/?id={{id}}", ID: "42"}
+	if err := Execute(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Result.Name != "Product 42" || e.Result.Price != "$10" {
+		t.Errorf("got %+v", e.Result)
+	}
+}
+
+func TestExecuteSingleStructCount(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/many" {
+			fmt.Fprint(w, `<div class="product"><h1>a</h1></div><div class="product"><h1>b</h1></div>`)
+		}
+	}))
+	defer ts.Close()
+	type brand struct {
+		Name string `scraper:".brand"`
+	}
+	type product struct {
+		Name  string `scraper:"h1"`
+		Brand brand
+	}
+	type endpoint struct {
+		URL    string
+		Result product
+	}
+	e := endpoint{URL: ts.URL + "/none"}
+	if err := Execute(&e); !errors.Is(err, ErrNoResult) {
+		t.Errorf("want ErrNoResult, got %v (%+v)", err, e.Result)
+	}
+	type listEndpoint struct {
+		URL    string
+		Result product `scraper:".product"`
+	}
+	l := listEndpoint{URL: ts.URL + "/none"}
+	if err := Execute(&l); !errors.Is(err, ErrNoResult) {
+		t.Errorf("want ErrNoResult, got %v", err)
+	}
+	l.URL = ts.URL + "/many"
+	if err := Execute(&l); !errors.Is(err, ErrMultipleResults) {
+		t.Errorf("want ErrMultipleResults, got %v", err)
+	}
+}
+
+func TestSetResultUnknownField(t *testing.T) {
+	type product struct {
+		Name string
+		note string
+	}
+	type endpoint struct {
+		Result []product
+	}
+	v := reflect.ValueOf(&endpoint{}).Elem()
+	for _, r := range []Result{{"Missing": "x"}, {"note": "x"}} {
+		err := setResultsToStruct([]Result{r}, v)
+		if err == nil || !strings.Contains(err.Error(), "no matching struct field") {
+			t.Errorf("%v: want no matching field error, got %v", r, err)
+		}
+	}
+}
+
+func TestExecuteTypedFields(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `
+			<div class="item">
+				<b class="price">12.50</b><b class="count">3</b><b class="ok">true</b>
+				<time datetime="2024-03-01">March 1</time><b class="tags">a|b| c</b>
+				<b class="ip">10.0.0.1</b>
+			</div>
+		`)
+	}))
+	defer ts.Close()
+	type item struct {
+		Price   float64    `scraper:".price"`
+		Count   int        `scraper:".count"`
+		OK      bool       `scraper:".ok"`
+		Date    time.Time  `scraper:"time | @datetime" layout:"2006-01-02"`
+		Tags    []string   `scraper:".tags" sep:"|"`
+		IP      netip.Addr `scraper:".ip"`
+		Count2  *int       `scraper:".count"`
+		Missing *float64   `scraper:".missing"`
+	}
+	type endpoint struct {
+		URL    string
+		Result item
+	}
+	e := endpoint{URL: ts.URL}
+	if err := Execute(&e); err != nil {
+		t.Fatal(err)
+	}
+	r := e.Result
+	if r.Price != 12.5 || r.Count != 3 || !r.OK {
+		t.Errorf("got %+v", r)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !r.Date.Equal(want) {
+		t.Errorf("got date %s, want %s", r.Date, want)
+	}
+	if !reflect.DeepEqual(r.Tags, []string{"a", "b", "c"}) {
+		t.Errorf("got tags %q", r.Tags)
+	}
+	if r.IP.String() != "10.0.0.1" {
+		t.Errorf("got ip %s", r.IP)
+	}
+	if r.Count2 == nil || *r.Count2 != 3 || r.Missing != nil {
+		t.Errorf("got pointers %v %v", r.Count2, r.Missing)
+	}
+}
+
+func TestExecuteMissingPointerFields(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `
+			<div class="item"><h2>a</h2><b class="price">1</b></div>
+			<div class="item"><h2>b</h2></div>
+			<div class="item"><b class="price">3</b></div>
+		`)
+	}))
+	defer ts.Close()
+	type item struct {
+		Name  string `scraper:"h2"`
+		Price *int   `scraper:".price"`
+	}
+	type endpoint struct {
+		URL    string
+		Result []item `scraper:".item"`
+	}
+	e := endpoint{URL: ts.URL}
+	if err := Execute(&e); err != nil {
+		t.Fatal(err)
+	}
+	// rows missing a pointer field are kept, others are excluded
+	if len(e.Result) != 2 || e.Result[0].Price == nil || *e.Result[0].Price != 1 || e.Result[1].Name != "b" || e.Result[1].Price != nil {
+		t.Fatalf("got %+v", e.Result)
+	}
+}
+
+func TestSetResultConversionErrors(t *testing.T) {
+	type item struct {
+		Price float64
+		Count int
+		Name  string
+	}
+	type endpoint struct {
+		Result []item
+	}
+	e := endpoint{}
+	v := reflect.ValueOf(&e).Elem()
+	err := setResultsToStruct([]Result{{"Price": "free", "Count": "3", "Name": "x"}}, v)
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != "Price" || fe.Value != "free" {
+		t.Fatalf("want Price FieldError, got %v", err)
+	}
+	if e.Result != nil {
+		t.Errorf("Result should be untouched, got %+v", e.Result)
+	}
+}
@@ -1,28 +1,73 @@
 package scraper
 
 import (
-	"crypto/subtle"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Result represents a result
-type Result map[string]string
+// Result represents a result. Values are strings unless the
+// field sets a type, or the endpoint is in JSON mode.
+type Result map[string]any
 
 // Config is a path → endpoint mapping
 type Config map[string]*Endpoint
 
 type Handler struct {
-	Config  Config            `opts:"-"`
-	Headers map[string]string `opts:"-"`
-	Auth    string            `help:"Basic auth credentials <user>:<pass>"`
-	Log     bool              `opts:"-"`
-	Debug   bool              `help:"Enable debug output"`
+	Config            Config            `opts:"-"`
+	Headers           map[string]string `opts:"-"`
+	Auth              string            `help:"Basic auth credentials <user>:<pass>"`
+	Users             []User            `opts:"-"`
+	Log               bool              `opts:"-"`
+	Debug             bool              `help:"Enable debug output"`
+	Timeout           time.Duration     `help:"Default upstream request timeout"`
+	Attempts          int               `help:"Default maximum upstream request attempts (retries failures)"`
+	HostRate          float64           `help:"Default maximum requests per second to each upstream host"`
+	HostConcurrency   int               `help:"Default maximum in-flight requests to each upstream host"`
+	HostDelay         time.Duration     `help:"Default minimum delay between requests to each upstream host"`
+	Proxy             []string          `help:"Default upstream proxy URL (http, https or socks5), rotated when repeated"`
+	ProxyRotate       string            `help:"Proxy rotation, round-robin or random"`
+	Impersonate       string            `help:"Default impersonated browser, chrome or firefox"`
+	ImpersonateOS     string            `help:"Default OS of the impersonated browser, windows, macos, linux, android, ios or random"`
+	HTTPVersion       string            `help:"Default HTTP version, 1.1 or 2 (negotiated by default)"`
+	UserAgent         []string          `help:"Default User-Agent header, picked at random when repeated"`
+	Scraper           *Scraper          `opts:"-"`
+	Cache             Cache             `opts:"-"`
+	CacheEntries      int               `help:"Maximum number of cached responses"`
+	CacheBytes        int               `help:"Maximum total size of cached responses in bytes"`
+	ClientRate        float64           `help:"Maximum requests per second from each client (by user or IP)"`
+	ClientBurst       int               `help:"Requests each client may make in a burst above the client rate"`
+	ClientConcurrency int               `help:"Maximum requests in progress from each client"`
+	SessionDir        string            `help:"Directory of the session files named in the config (disables them when unset)"`
+	mu                sync.RWMutex      // guards Config, Users and the installed config below
+	all               *allSettings
+	endpoints         Config
+	routes            routes
+	clientLimit       ClientLimit
+	cacheOnce         sync.Once
+	flights           flightGroup
+	clients           clientLimiter
+	limitersMu        sync.Mutex
+	limiters          map[string]*clientLimiter
+}
+
+// allEndpoints is the config key of the settings
+// which apply across all endpoints
+const allEndpoints = "*"
+
+// allSettings are the settings under the allEndpoints key
+type allSettings struct {
+	ClientLimit *ClientLimit `json:"clientLimit,omitempty"`
 }
 
 func (h *Handler) LoadConfigFile(path string) error {
@@ -33,12 +78,23 @@ func (h *Handler) LoadConfigFile(path string) error {
 	return h.LoadConfig(b)
 }
 
+// LoadConfig parses and installs an endpoint configuration. The
+// configuration is kept as given, and served back by GET /, while
+// handler-level settings are applied to copies of its endpoints.
+// It may be called while the handler is serving requests.
 func (h *Handler) LoadConfig(b []byte) error {
 	c := Config{}
 	// json unmarshal performs selector validation
 	if err := json.Unmarshal(b, &c); err != nil {
 		return err
 	}
+	all, err := parseAllSettings(b)
+	if err != nil {
+		return err
+	}
+	endpoints := Config{}
+	// session file → name of the session saving to it
+	files := map[string]string{}
 	for k, e := range c {
 		// normalise path: lookup later strips the leading slash
 		if strings.HasPrefix(k, "/") {
@@ -46,43 +102,259 @@ func (h *Handler) LoadConfig(b []byte) error {
 			k = strings.TrimPrefix(k, "/")
 			c[k] = e
 		}
+		if k == allEndpoints {
+			// kept as allSettings, not as an endpoint
+			delete(c, k)
+			continue
+		}
 		if h.Log {
 			logf("Loaded endpoint: /%s", k)
 		}
-		// inherit handler-level Debug + Headers (per-endpoint values win)
-		e.Debug = h.Debug
-		if e.Headers == nil {
-			e.Headers = h.Headers
-		} else {
-			for k, v := range h.Headers {
-				if _, ok := e.Headers[k]; !ok {
-					e.Headers[k] = v
-				}
+		rt, err := h.endpoint(k, e)
+		if err != nil {
+			return err
+		}
+		if s := rt.Session; s != nil && s.File != "" {
+			if name, ok := files[s.File]; ok && name != s.Name {
+				return fmt.Errorf("/%s: session file %q is saved by another session, share it with a session name", k, e.Session.File)
 			}
+			files[s.File] = s.Name
 		}
+		endpoints[k] = rt
+	}
+	rs, err := newRoutes(endpoints)
+	if err != nil {
+		return err
 	}
 	if h.Debug {
 		logf("Enabled debug mode")
 	}
+	// client limits across all endpoints (config values win)
+	l := ClientLimit{}
+	if all.ClientLimit != nil {
+		l = *all.ClientLimit
+	}
+	if l.Rate == 0 {
+		l.Rate = h.ClientRate
+	}
+	if l.Burst == 0 {
+		l.Burst = h.ClientBurst
+	}
+	if l.Concurrency == 0 {
+		l.Concurrency = h.ClientConcurrency
+	}
+	h.mu.Lock()
 	h.Config = c
+	h.all = all
+	h.endpoints = endpoints
+	h.routes = rs
+	h.clientLimit = l
+	h.mu.Unlock()
+	// cached responses may be stale under the new config
+	h.cache().Purge("")
 	return nil
 }
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// basic auth
-	if h.Auth != "" {
-		u, p, _ := r.BasicAuth()
-		if subtle.ConstantTimeCompare([]byte(u+":"+p), []byte(h.Auth)) != 1 {
-			w.Header().Set("WWW-Authenticate", `Basic realm="scraper"`)
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Access Denied"))
-			return
+// endpoint returns a copy of the endpoint at path which inherits
+// the handler-level settings (per-endpoint values win)
+func (h *Handler) endpoint(path string, e *Endpoint) (*Endpoint, error) {
+	rt := *e
+	rt.Debug = h.Debug
+	rt.Scraper = h.Scraper
+	rt.clients = h.limiter(path)
+	if err := rt.validateBefore(); err != nil {
+		return nil, fmt.Errorf("/%s: %w", path, err)
+	}
+	if len(rt.Before) > 0 && rt.Session == nil {
+		// before steps log in through the session's cookies
+		rt.Session = &Session{}
+	}
+	if rt.Session != nil && (rt.Session.Name == "" || rt.Session.File != "") {
+		s := *rt.Session
+		if s.Name == "" {
+			// keeps the session across config reloads
+			s.Name = "/" + path
+		}
+		if s.File != "" {
+			file, err := h.sessionFile(s.File)
+			if err != nil {
+				return nil, fmt.Errorf("/%s: %w", path, err)
+			}
+			s.File = file
+		}
+		rt.Session = &s
+	}
+	if rt.Timeout == 0 {
+		rt.Timeout = Duration(h.Timeout)
+	}
+	if h.Attempts > 1 {
+		r := Retry{}
+		if rt.Retry != nil {
+			r = *rt.Retry
+		}
+		if r.Attempts == 0 {
+			r.Attempts = h.Attempts
 		}
+		rt.Retry = &r
+	} else if rt.Retry != nil && rt.Retry.Attempts == 0 {
+		// the retry block would never retry
+		return nil, fmt.Errorf("/%s: retry: attempts is required when --attempts is not above 1", path)
+	}
+	if h.HostRate > 0 || h.HostConcurrency > 0 || h.HostDelay > 0 {
+		l := Limit{}
+		if rt.Limit != nil {
+			l = *rt.Limit
+		}
+		if l.Rate == 0 {
+			l.Rate = h.HostRate
+		}
+		if l.Concurrency == 0 {
+			l.Concurrency = h.HostConcurrency
+		}
+		if l.Delay == 0 {
+			l.Delay = Duration(h.HostDelay)
+		}
+		rt.Limit = &l
+	}
+	if rt.Proxy == nil && len(h.Proxy) > 0 {
+		rt.Proxy = &Proxy{URLs: h.Proxy, Rotate: h.ProxyRotate}
+		if err := rt.Proxy.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if h.Impersonate != "" || h.ImpersonateOS != "" || h.HTTPVersion != "" || len(h.UserAgent) > 0 {
+		b := Browser{}
+		if rt.Browser != nil {
+			b = *rt.Browser
+		}
+		if b.Impersonate == "" {
+			b.Impersonate = h.Impersonate
+		}
+		if b.OS == "" && b.impersonates() {
+			b.OS = h.ImpersonateOS
+		}
+		if b.HTTP == "" {
+			b.HTTP = h.HTTPVersion
+		}
+		if len(b.UserAgents) == 0 {
+			b.UserAgents = h.UserAgent
+		}
+		if err := b.validate(); err != nil {
+			return nil, err
+		}
+		rt.Browser = &b
+	}
+	if b := rt.Browser; b != nil && b.OS != "" && !b.impersonates() {
+		return nil, fmt.Errorf("/%s: browser: os %q is only used with impersonate", path, b.OS)
+	}
+	if len(h.Headers) > 0 {
+		headers := map[string]string{}
+		for k, v := range h.Headers {
+			headers[k] = v
+		}
+		for k, v := range rt.Headers {
+			headers[k] = v
+		}
+		rt.Headers = headers
+	}
+	if err := rt.compileXPaths(); err != nil {
+		return nil, fmt.Errorf("/%s: %w", path, err)
+	}
+	return &rt, nil
+}
+
+// sessionFile resolves a session file of the config within the
+// SessionDir, since configs posted by admins must not be able to
+// overwrite other files on the host
+func (h *Handler) sessionFile(file string) (string, error) {
+	if h.SessionDir == "" {
+		return "", fmt.Errorf("session file %q requires a session directory (--session-dir)", file)
+	}
+	if !filepath.IsLocal(file) {
+		return "", fmt.Errorf("session file %q must be a relative path within the session directory", file)
+	}
+	return filepath.Join(h.SessionDir, file), nil
+}
+
+// configJSON is the installed config as served by GET /, along with
+// its allEndpoints settings. It expects the read lock to be held.
+func (h *Handler) configJSON() map[string]any {
+	c := map[string]any{}
+	for k, e := range h.Config {
+		c[k] = e
+	}
+	if h.all != nil && h.all.ClientLimit != nil {
+		c[allEndpoints] = h.all
+	}
+	return c
+}
+
+// parseAllSettings parses the settings under the allEndpoints key
+// of a config, which must not set anything else
+func parseAllSettings(b []byte) (*allSettings, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	s := &allSettings{}
+	v, ok := raw[allEndpoints]
+	if !ok {
+		v, ok = raw["/"+allEndpoints]
+	}
+	if !ok {
+		return s, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("%q may only set clientLimit: %w", allEndpoints, err)
+	}
+	return s, nil
+}
+
+// limiter returns the client limiter of the endpoint at path,
+// which is kept across config reloads
+func (h *Handler) limiter(path string) *clientLimiter {
+	h.limitersMu.Lock()
+	defer h.limitersMu.Unlock()
+	if h.limiters == nil {
+		h.limiters = map[string]*clientLimiter{}
+	}
+	l, ok := h.limiters[path]
+	if !ok {
+		l = &clientLimiter{}
+		h.limiters[path] = l
+	}
+	return l
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// basic auth or token
+	user, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="scraper"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Access Denied"))
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	// admin actions on root
 	if r.URL.Path == "" || r.URL.Path == "/" {
+		if !user.admin() {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(jsonerr(fmt.Errorf("user %s is not an admin", user.Name)))
+			return
+		}
 		switch r.Method {
+		case http.MethodDelete:
+			// purge cached responses, optionally of one endpoint
+			prefix := ""
+			if p := r.URL.Query().Get("endpoint"); p != "" {
+				prefix = strings.TrimPrefix(p, "/") + " "
+			}
+			n := h.cache().Purge(prefix)
+			w.Write([]byte(`{"purged":` + strconv.Itoa(n) + `}`))
+			return
 		case http.MethodGet:
 			// fall through to write config
 		case http.MethodPost:
@@ -99,10 +371,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write(jsonerr(errors.New("use GET or POST")))
+			w.Write(jsonerr(errors.New("use GET, POST or DELETE")))
 			return
 		}
-		b, err := json.MarshalIndent(h.Config, "", "  ")
+		h.mu.RLock()
+		b, err := json.MarshalIndent(h.configJSON(), "", "  ")
+		h.mu.RUnlock()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(jsonerr(err))
@@ -113,12 +387,33 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	// endpoint id (excludes root slash)
 	id := r.URL.Path[1:]
-	endpoint := h.Endpoint(id)
-	if endpoint == nil {
+	h.mu.RLock()
+	rs, limit := h.routes, h.clientLimit
+	h.mu.RUnlock()
+	route, vars := rs.match(id)
+	if route == nil {
 		w.WriteHeader(http.StatusNotFound)
 		w.Write(jsonerr(fmt.Errorf("endpoint /%s not found", id)))
 		return
 	}
+	if !user.allowed(route.path, id) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(jsonerr(fmt.Errorf("user %s may not use endpoint /%s", user.Name, id)))
+		return
+	}
+	endpoint := route.endpoint
+	// client limits across all endpoints, then of this endpoint
+	client := clientID(r, user)
+	release, ok := limitClient(w, client, &h.clients, &limit)
+	if !ok {
+		return
+	}
+	defer release()
+	release, ok = limitClient(w, client, endpoint.clients, endpoint.ClientLimit)
+	if !ok {
+		return
+	}
+	defer release()
 	// Repeated query params (?tag=a&tag=b) collapse to a comma-joined value
 	// (?tag=a,b). The template engine handles URL-escaping when the param sits
 	// after the URL's `?`, so the resulting string is still a valid query.
@@ -126,29 +421,124 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	for k, v := range r.URL.Query() {
 		values[k] = strings.Join(v, ",")
 	}
-	res, err := endpoint.Execute(values)
+	// path variables take precedence over query params
+	for k, v := range vars {
+		values[k] = v
+	}
+	if endpoint.Cache > 0 {
+		h.serveCached(w, r, user, route.path, endpoint, values)
+		return
+	}
+	b, err := h.execute(r.Context(), endpoint, values)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write(jsonerr(err))
+		h.writeError(w, r, err)
 		return
 	}
-	enc := json.NewEncoder(w)
-	enc.SetEscapeHTML(false)
-	enc.SetIndent("", "  ")
+	w.Write(b)
+}
+
+// serveCached responds from the cache, or executes the endpoint
+// and caches its response. Concurrent misses share one execution.
+// Responses to authenticated users (non-nil) may only be stored
+// by the client, not by shared caches.
+func (h *Handler) serveCached(w http.ResponseWriter, r *http.Request, user *User, path string, endpoint *Endpoint, values map[string]string) {
+	key := endpoint.cacheKey(path, values)
+	cache := h.cache()
+	status := "HIT"
+	entry, ok := cache.Get(key)
+	if !ok {
+		status = "MISS"
+		var err error
+		entry, err = h.flights.do(r.Context(), key, func(ctx context.Context) (*CacheEntry, error) {
+			b, err := h.execute(ctx, endpoint, values)
+			if err != nil {
+				return nil, err
+			}
+			now := time.Now()
+			entry := &CacheEntry{Value: b, Created: now, Expires: now.Add(time.Duration(endpoint.Cache))}
+			cache.Set(key, entry)
+			return entry, nil
+		})
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	}
+	now := time.Now()
+	age := int(now.Sub(entry.Created) / time.Second)
+	maxAge := int(entry.Expires.Sub(now) / time.Second)
+	scope := "public"
+	if user != nil {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(max(maxAge, 0)))
+	w.Header().Set("Age", strconv.Itoa(age))
+	w.Header().Set("X-Cache", status)
+	w.Write(entry.Value)
+}
+
+// execute runs the endpoint and encodes its response
+func (h *Handler) execute(ctx context.Context, endpoint *Endpoint, values map[string]string) ([]byte, error) {
+	res, err := endpoint.ExecuteContext(ctx, values)
+	if err != nil {
+		return nil, err
+	}
 	var v any
-	if endpoint.List == "" && len(res) == 1 {
+	if endpoint.single() && len(res) == 1 {
 		v = res[0]
 	} else {
 		v = res
 	}
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
 	if err := enc.Encode(v); err != nil {
-		w.Write([]byte("JSON Error: " + err.Error()))
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeError responds with the given endpoint error
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// client disconnected, nobody to respond to
+		if h.Debug {
+			logf("canceled %s", r.URL.Path)
+		}
+		return
 	}
+	var uerr *UpstreamError
+	if errors.As(err, &uerr) {
+		// the remote server failed, not us
+		status := http.StatusBadGateway
+		if uerr.Timeout() {
+			status = http.StatusGatewayTimeout
+		}
+		w.WriteHeader(status)
+		w.Write(upstreamerr(err, uerr))
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(jsonerr(err))
+}
+
+// cache returns the response cache, creating a MemoryCache when unset
+func (h *Handler) cache() Cache {
+	h.cacheOnce.Do(func() {
+		if h.Cache == nil {
+			h.Cache = NewMemoryCache(h.CacheEntries, h.CacheBytes)
+		}
+	})
+	return h.Cache
 }
 
-// Endpoint returns the endpoint registered at path, or nil if missing.
+// Endpoint returns the endpoint registered at path, with the
+// handler-level settings applied, or nil if missing.
 func (h *Handler) Endpoint(path string) *Endpoint {
-	if e, ok := h.Config[path]; ok {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if e, ok := h.endpoints[path]; ok {
 		return e
 	}
 	return nil
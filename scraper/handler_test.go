@@ -0,0 +1,98 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandlerClientDisconnect(t *testing.T) {
+	aborted := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer ts.Close()
+	h := &Handler{}
+	if err := h.LoadConfig([]byte(`{"/slow": {"url": "` + ts.URL + `", "result": {"title": "h1"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("GET", "/slow", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request was not aborted")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not return")
+	}
+}
+
+func TestHandlerConfigWithoutDefaults(t *testing.T) {
+	h := &Handler{Timeout: 5 * time.Second, Attempts: 3, HostRate: 1, Proxy: []string{"http://proxy:8080"}, UserAgent: []string{"bot"}, Headers: map[string]string{"X-A": "a"}}
+	config := `{"/a":{"url":"http://example.com","result":{"x":"h1"},"session":true},"b":{"url":"http://example.com","result":{"x":"h1"},"retry":{"backoff":"1s"}}}`
+	if err := h.LoadConfig([]byte(config)); err != nil {
+		t.Fatal(err)
+	}
+	if a := h.Endpoint("a"); a.Retry.attempts() != 3 || a.Proxy == nil || a.Session.Name != "/a" || a.Headers["X-A"] != "a" {
+		t.Fatalf("expected the handler defaults, got %+v", a)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	c := Config{}
+	if err := json.Unmarshal([]byte(strings.Replace(config, `"/a"`, `"a"`, 1)), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := json.MarshalIndent(c, "", "  "); rec.Body.String() != string(want) {
+		t.Fatalf("expected the posted config\n%s, got\n%s", want, rec.Body)
+	}
+}
+
+func TestHandlerReloadWhileServing(t *testing.T) {
+	rt := &recorder{body: `<h1>ok</h1>`}
+	h := &Handler{Scraper: &Scraper{Transport: rt}}
+	config := []byte(`{"/a": {"url": "https://example.invalid/a", "result": {"x": "h1"}}}`)
+	if err := h.LoadConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	users := []User{{Name: "ops", Token: "t", Role: RoleAdmin}}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			if err := h.LoadConfig(config); err != nil {
+				t.Error(err)
+			}
+			h.SetUsers(users)
+			h.Endpoint("a")
+		}
+	}()
+	for _, path := range []string{"/a", "/"} {
+		for range 20 {
+			r := httptest.NewRequest("GET", path, nil)
+			r.Header.Set("X-API-Key", "t")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != 200 && rec.Code != http.StatusUnauthorized {
+				t.Fatalf("%s: unexpected status %d", path, rec.Code)
+			}
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,136 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Limit controls how politely requests are sent to each upstream host.
+// Requests exceeding the limit are queued until allowed, or until
+// their context is done.
+type Limit struct {
+	// Rate is the maximum number of requests per second
+	Rate float64 `json:"rate,omitempty"`
+	// Burst is the number of requests which may exceed Rate
+	// after an idle period (defaults to 1)
+	Burst int `json:"burst,omitempty"`
+	// Concurrency is the maximum number of requests in flight
+	Concurrency int `json:"concurrency,omitempty"`
+	// Delay is the minimum time between the start of two requests
+	Delay Duration `json:"delay,omitempty"`
+}
+
+// enabled reports whether the limit restricts anything, nil-safe
+func (l *Limit) enabled() bool {
+	return l != nil && (l.Rate > 0 || l.Concurrency > 0 || l.Delay > 0)
+}
+
+// hostLimiter is the request state of one upstream host
+type hostLimiter struct {
+	mu       sync.Mutex
+	tokens   float64
+	refilled time.Time
+	last     time.Time
+	inflight int
+	released chan struct{}
+}
+
+// acquire waits until a request is allowed by l, and
+// returns a func to be called once the request is done
+func (h *hostLimiter) acquire(ctx context.Context, l *Limit) (func(), error) {
+	for {
+		h.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		var released chan struct{}
+		if l.Concurrency > 0 && h.inflight >= l.Concurrency {
+			if h.released == nil {
+				h.released = make(chan struct{})
+			}
+			released = h.released
+		} else {
+			if l.Rate > 0 {
+				burst := float64(max(l.Burst, 1))
+				if h.refilled.IsZero() {
+					h.tokens = burst
+				} else {
+					h.tokens = min(burst, h.tokens+now.Sub(h.refilled).Seconds()*l.Rate)
+				}
+				h.refilled = now
+				if h.tokens < 1 {
+					wait = time.Duration((1 - h.tokens) / l.Rate * float64(time.Second))
+				}
+			}
+			if d := time.Duration(l.Delay); d > 0 && !h.last.IsZero() {
+				wait = max(wait, h.last.Add(d).Sub(now))
+			}
+			if wait <= 0 {
+				if l.Rate > 0 {
+					h.tokens--
+				}
+				h.last = now
+				h.inflight++
+				h.mu.Unlock()
+				return h.release, nil
+			}
+		}
+		h.mu.Unlock()
+		var timer *time.Timer
+		var ready <-chan time.Time
+		if released == nil {
+			timer = time.NewTimer(wait)
+			ready = timer.C
+		}
+		select {
+		case <-released:
+		case <-ready:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release ends an in-flight request, waking queued requests
+func (h *hostLimiter) release() {
+	h.mu.Lock()
+	h.inflight--
+	if h.released != nil {
+		close(h.released)
+		h.released = nil
+	}
+	h.mu.Unlock()
+}
+
+// wait queues the request to rawURL until the endpoint's limit
+// allows it, and returns a func to be called once it is done
+func (s *Scraper) wait(ctx context.Context, e *Endpoint, rawURL string) (func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	s.hostsMu.Lock()
+	if s.hosts == nil {
+		s.hosts = map[string]*hostLimiter{}
+	}
+	h, ok := s.hosts[u.Host]
+	if !ok {
+		h = &hostLimiter{}
+		s.hosts[u.Host] = h
+	}
+	s.hostsMu.Unlock()
+	start := time.Now()
+	release, err := h.acquire(ctx, e.Limit)
+	if waited := time.Since(start); e.Debug && waited >= time.Millisecond {
+		logf("queued %s for %s", u.Host, waited.Round(time.Millisecond))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(release) }, nil
+}
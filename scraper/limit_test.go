@@ -0,0 +1,157 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	var inflight, peak int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+		w.Write([]byte(`<h1>ok</h1>`))
+	}))
+	defer ts.Close()
+	e := &Endpoint{
+		URL:     ts.URL,
+		Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+		Limit:   &Limit{Concurrency: 2},
+		Scraper: &Scraper{},
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := e.Execute(nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", peak)
+	}
+}
+
+func TestLimitFollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list":
+			w.Write([]byte(`<div class="item"><a href="/item/1">x</a></div><div class="item"><a href="/item/2">x</a></div>`))
+		case "/item/1", "/item/2":
+			w.Write([]byte(`<h1>` + r.URL.Path + `</h1><a href="/seller">x</a>`))
+		default:
+			w.Write([]byte(`<h1>seller</h1>`))
+		}
+	}))
+	defer ts.Close()
+	var config Config
+	err := json.Unmarshal([]byte(`{"list": {
+		"url": "`+ts.URL+`/list",
+		"list": ".item",
+		"limit": {"concurrency": 1},
+		"result": {
+			"detail": {
+				"follow": ["a", "@href"],
+				"result": {
+					"title": "h1",
+					"seller": {"follow": ["a", "@href"], "result": {"name": "h1"}}
+				}
+			}
+		}
+	}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// detail pages share the single slot of their host
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := config["list"].ExecuteContext(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 results, got %v", res)
+	}
+	for _, r := range res {
+		d, _ := r["detail"].(Result)
+		if s, _ := d["seller"].(Result); s["name"] != "seller" {
+			t.Errorf("expected followed seller, got %v", r)
+		}
+	}
+}
+
+func TestLimitRateAndDelay(t *testing.T) {
+	for _, l := range []*Limit{
+		{Rate: 20},
+		{Delay: Duration(50 * time.Millisecond)},
+	} {
+		rt := &recorder{body: `<h1>ok</h1>`}
+		e := &Endpoint{
+			URL:     "https://example.invalid/",
+			Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+			Limit:   l,
+			Scraper: &Scraper{Transport: rt},
+		}
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if _, err := e.Execute(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the first request is immediate, the others wait 50ms each
+		if d := time.Since(start); d < 95*time.Millisecond {
+			t.Errorf("%+v: 3 requests took %s", l, d)
+		}
+	}
+}
+
+func TestLimitCancel(t *testing.T) {
+	h := &hostLimiter{}
+	l := &Limit{Concurrency: 1}
+	release, err := h.acquire(context.Background(), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := h.acquire(ctx, l); err != context.DeadlineExceeded {
+		t.Fatalf("expected queued request to be canceled, got %v", err)
+	}
+	release()
+	if _, err := h.acquire(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerLimitDefaults(t *testing.T) {
+	h := &Handler{HostRate: 5, HostDelay: time.Second}
+	err := h.LoadConfig([]byte(`{
+		"/a": {"url": "http://example.com", "result": {"x": "h1"}},
+		"/b": {"url": "http://example.com", "result": {"x": "h1"}, "limit": {"rate": 1, "concurrency": 2}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := h.Endpoint("a").Limit; *l != (Limit{Rate: 5, Delay: Duration(time.Second)}) {
+		t.Errorf("got %+v", l)
+	}
+	if l := h.Endpoint("b").Limit; *l != (Limit{Rate: 1, Concurrency: 2, Delay: Duration(time.Second)}) {
+		t.Errorf("got %+v", l)
+	}
+}
@@ -0,0 +1,138 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// defaultMaxPages bounds pagination when no limit is configured
+const defaultMaxPages = 10
+
+// pagination stop conditions
+const (
+	stopEmpty  = "empty"   // stop when a page has no list items
+	stopNoNext = "no-next" // stop when a page has no next link
+)
+
+// Paginate describes how an Endpoint fetches multiple pages. Pages are
+// found either by following a "next" link, or by incrementing a template
+// variable (e.g. {{page}} or {{offset}}) used in the URL or body.
+type Paginate struct {
+	// Next extracts the next page URL (a CSS selector in html
+	// mode, a jq selector in json mode). Relative URLs are resolved
+	// against the current page.
+	Next Extractors `json:"next,omitempty"`
+	// Param is the template variable set to the page number
+	Param string `json:"param,omitempty"`
+	// Start is the first value of Param (defaults to 1)
+	Start *int `json:"start,omitempty"`
+	// Step is added to Param for each page (defaults to 1)
+	Step int `json:"step,omitempty"`
+	// MaxPages is the maximum number of pages to fetch (defaults to 10)
+	MaxPages int `json:"maxPages,omitempty"`
+	// Stop is "empty" or "no-next". By default, pagination stops at
+	// whichever comes first. A missing next link always ends link
+	// pagination.
+	Stop string `json:"stop,omitempty"`
+}
+
+func (p *Paginate) UnmarshalJSON(data []byte) error {
+	type paginate Paginate
+	if err := json.Unmarshal(data, (*paginate)(p)); err != nil {
+		return err
+	}
+	return p.validate()
+}
+
+func (p *Paginate) validate() error {
+	if len(p.Next) == 0 && p.Param == "" {
+		return errors.New("paginate: expected next or param")
+	}
+	if len(p.Next) > 0 && p.Param != "" && p.Stop != stopNoNext {
+		return errors.New(`paginate: next and param may only be combined with stop "no-next"`)
+	}
+	switch p.Stop {
+	case "", stopEmpty:
+	case stopNoNext:
+		if len(p.Next) == 0 {
+			return errors.New(`paginate: stop "no-next" requires next`)
+		}
+	default:
+		return fmt.Errorf("paginate: unknown stop condition %q (expected %q or %q)", p.Stop, stopEmpty, stopNoNext)
+	}
+	if p.MaxPages < 0 {
+		return errors.New("paginate: maxPages must be positive")
+	}
+	return nil
+}
+
+// execute fetches each page of e, concatenating the results
+func (p *Paginate) execute(ctx context.Context, e *Endpoint, params map[string]string) ([]Result, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	max := p.MaxPages
+	if max == 0 {
+		max = defaultMaxPages
+	}
+	start, step := 1, p.Step
+	if p.Start != nil {
+		start = *p.Start
+	}
+	if step == 0 {
+		step = 1
+	}
+	vars := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		vars[k] = v
+	}
+	// in param mode each page re-templates the endpoint URL,
+	// in link mode pages after the first fetch the next link
+	link := p.Param == ""
+	var all []Result
+	seen := map[string]bool{}
+	pageURL := ""
+	for page := 0; page < max; page++ {
+		if !link {
+			vars[p.Param] = strconv.Itoa(start + page*step)
+		}
+		results, next, err := e.executePage(ctx, vars, pageURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("page %d: %w", page+1, err)
+		}
+		all = append(all, results...)
+		if e.Debug {
+			logf("page %d: %d results (next: %q)", page+1, len(results), next)
+		}
+		if len(results) == 0 && p.Stop != stopNoNext {
+			break
+		}
+		if len(p.Next) > 0 {
+			if next == "" || seen[next] {
+				break
+			}
+			seen[next] = true
+		}
+		if link {
+			pageURL = next
+		}
+	}
+	return all, nil
+}
+
+// resolveURL resolves ref against base, returning ref
+// unchanged if it cannot be parsed
+func resolveURL(base *url.URL, ref string) string {
+	r, err := url.Parse(ref)
+	if err != nil || base == nil {
+		return ref
+	}
+	return base.ResolveReference(r).String()
+}
@@ -0,0 +1,108 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPaginateNextLink(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := strconv.Atoi(r.URL.Query().Get("p"))
+		fmt.Fprintf(w, `<div class="item">item%d-a</div><div class="item">item%d-b</div>`, p, p)
+		if p < 3 {
+			fmt.Fprintf(w, `<a class="next" href="/list?p=%d">next</a>`, p+1)
+		}
+	}))
+	defer ts.Close()
+	e := &Endpoint{
+		URL:  ts.URL + "/list?p=1",
+		List: ".item",
+		Paginate: &Paginate{
+			Next: mustExtractors(t, "a.next", "@href"),
+		},
+		Result: map[string]Field{
+			"name": {Extract: mustExtractors(t, "/.*/")},
+		},
+	}
+	res, err := e.Execute(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 6 {
+		t.Fatalf("got %d results, want 6: %v", len(res), res)
+	}
+	if res[5]["name"] != "item3-b" {
+		t.Errorf("last result = %v", res[5])
+	}
+}
+
+func TestPaginateParam(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		items := []map[string]int{}
+		for i := offset; i < offset+2 && i < 5; i++ {
+			items = append(items, map[string]int{"id": i})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"items": items})
+	}))
+	defer ts.Close()
+	start := 0
+	e := &Endpoint{
+		Mode: "json",
+		URL:  ts.URL + "/api?offset={{offset}}",
+		List: ".items[]",
+		Paginate: &Paginate{
+			Param: "offset",
+			Start: &start,
+			Step:  2,
+		},
+		Result: map[string]Field{
+			"id": {Extract: mustExtractors(t, ".id")},
+		},
+	}
+	res, err := e.Execute(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 5 {
+		t.Fatalf("got %d results, want 5: %v", len(res), res)
+	}
+	// offsets 0, 2, 4, then an empty page at 6
+	if requests != 4 {
+		t.Errorf("got %d requests, want 4", requests)
+	}
+	// max pages
+	e.Paginate.MaxPages = 2
+	requests = 0
+	res, err = e.Execute(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 4 || requests != 2 {
+		t.Errorf("got %d results from %d requests, want 4 from 2", len(res), requests)
+	}
+}
+
+func TestPaginateValidate(t *testing.T) {
+	for input, want := range map[string]string{
+		`{}`:                                     "expected next or param",
+		`{"param":"page","stop":"no-next"}`:      "requires next",
+		`{"param":"page","stop":"forever"}`:      "unknown stop condition",
+		`{"param":"page","next":"a.next"}`:       "may only be combined",
+		`{"next":"a.next","maxPages":-1}`:        "maxPages",
+		`{"param":"page","next":"a","stop":"x"}`: "may only be combined",
+	} {
+		p := &Paginate{}
+		err := json.Unmarshal([]byte(input), p)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want error containing %q, got %v", input, want, err)
+		}
+	}
+}
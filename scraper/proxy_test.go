@@ -0,0 +1,126 @@
+package scraper
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// proxyServer is an HTTP proxy, supporting both CONNECT tunnels
+// and absolute-URL requests, which counts its requests
+func proxyServer(count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		if r.Method == http.MethodConnect {
+			upstream, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			conn, buf, _ := w.(http.Hijacker).Hijack()
+			go func() {
+				io.Copy(upstream, buf)
+				upstream.Close()
+			}()
+			io.Copy(conn, upstream)
+			conn.Close()
+			return
+		}
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+}
+
+func TestProxy(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<h1>hello</h1>`))
+	}))
+	defer ts.Close()
+	var a, b int32
+	pa, pb := proxyServer(&a), proxyServer(&b)
+	defer pa.Close()
+	defer pb.Close()
+	for _, s := range []*Scraper{{}, {Transport: http.DefaultTransport.(*http.Transport).Clone()}} {
+		a, b = 0, 0
+		e := &Endpoint{
+			URL:     ts.URL,
+			Proxy:   &Proxy{URLs: []string{pa.URL, pb.URL}},
+			Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+			Scraper: s,
+		}
+		for range 4 {
+			res, err := e.Execute(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res[0]["title"] != "hello" {
+				t.Fatalf("expected hello, got %v", res)
+			}
+		}
+		// tunnels are kept alive, so only plain proxy requests are counted
+		if a == 0 || b == 0 || (s.Transport != nil && (a != 2 || b != 2)) {
+			t.Fatalf("expected round robin, got %d and %d requests", a, b)
+		}
+	}
+}
+
+func TestProxyEject(t *testing.T) {
+	cfg := &Proxy{URLs: []string{"http://a:1", "http://b:1"}, Failures: 2, Eject: Duration(time.Hour)}
+	p := &proxyPool{}
+	picks := func(n int, ok bool) []string {
+		urls := []string{}
+		for range n {
+			u, done := p.pick(cfg)
+			done(ok && u != "http://a:1")
+			urls = append(urls, u)
+		}
+		return urls
+	}
+	// a fails twice, and is then ejected
+	got := picks(6, true)
+	want := []string{"http://a:1", "http://b:1", "http://a:1", "http://b:1", "http://b:1", "http://b:1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	// b is ejected too: the first to return is used
+	picks(2, false)
+	if u, _ := p.pick(cfg); u != "http://a:1" {
+		t.Fatalf("expected a, got %s", u)
+	}
+}
+
+func TestProxyJSON(t *testing.T) {
+	for input, want := range map[string]int{
+		`"http://a:1"`:                   1,
+		`["http://a:1", "socks5://b:1"]`: 2,
+		`{"urls": ["http://a:1"], "rotate": "random", "eject": "30s"}`: 1,
+	} {
+		var p Proxy
+		if err := json.Unmarshal([]byte(input), &p); err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		if len(p.URLs) != want {
+			t.Fatalf("%s: expected %d urls, got %v", input, want, p.URLs)
+		}
+	}
+	for _, input := range []string{`"ftp://a:1"`, `[]`, `"a:1"`, `{"urls": ["http://a:1"], "rotate": "sticky"}`} {
+		var p Proxy
+		if err := json.Unmarshal([]byte(input), &p); err == nil {
+			t.Fatalf("%s: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retry defaults
+const (
+	defaultBackoff    = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// defaultRetryStatuses are the upstream status codes retried by default
+var defaultRetryStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// defaultRetryMethods are the idempotent methods retried by default
+var defaultRetryMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// Retry is an upstream retry policy. Failed requests (network errors,
+// timeouts and retryable status codes) are retried with exponential
+// backoff and jitter, up to Attempts requests in total.
+type Retry struct {
+	// Attempts is the maximum number of requests, including the first
+	Attempts int `json:"attempts,omitempty"`
+	// Backoff is the delay before the first retry, which doubles on each
+	// following retry (defaults to 500ms)
+	Backoff Duration `json:"backoff,omitempty"`
+	// MaxBackoff caps the delay between retries (defaults to 30s)
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+	// Statuses are the retryable status codes
+	// (defaults to 408, 429, 502, 503 and 504)
+	Statuses []int `json:"statuses,omitempty"`
+	// Methods are the retryable request methods (defaults to the
+	// idempotent GET, HEAD, OPTIONS, PUT and DELETE)
+	Methods []string `json:"methods,omitempty"`
+}
+
+// attempts returns the maximum number of requests, nil-safe
+func (r *Retry) attempts() int {
+	if r == nil || r.Attempts < 1 {
+		return 1
+	}
+	return r.Attempts
+}
+
+// retryable reports whether a failed attempt should be retried
+func (r *Retry) retryable(method string, resp *response, err error) bool {
+	methods := r.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	if !slices.ContainsFunc(methods, func(m string) bool { return strings.EqualFold(m, method) }) {
+		// the server may have processed the request
+		return false
+	}
+	if err != nil {
+		var perr *permanentError
+		return !errors.As(err, &perr)
+	}
+	statuses := r.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryStatuses
+	}
+	for _, s := range statuses {
+		if resp.StatusCode == s {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the wait before retry n (1-based). The server's
+// Retry-After header is honoured when present.
+func (r *Retry) delay(n int, resp *response) time.Duration {
+	limit := time.Duration(r.MaxBackoff)
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return min(d, limit)
+		}
+	}
+	d := time.Duration(r.Backoff)
+	if d <= 0 {
+		d = defaultBackoff
+	}
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	//jitter between d/2 and d
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses a Retry-After header value
+// given in seconds or as an HTTP date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// do sends a request with the endpoint's headers, retrying
+// according to the endpoint's retry policy
+func (e *Endpoint) do(ctx context.Context, method, url, body string) (*response, error) {
+	if e.Debug {
+		if body != "" {
+			logf("req: %s %s (body size %d)", method, url, len(body))
+		} else {
+			logf("req: %s %s", method, url)
+		}
+		for k, v := range e.Headers {
+			logf("header: %s=%s", k, v)
+		}
+	}
+	attempts := e.Retry.attempts()
+	for n := 1; ; n++ {
+		resp, err := e.attempt(ctx, method, url, body)
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if n >= attempts || !e.Retry.retryable(method, resp, err) {
+			if err == nil && e.Debug {
+				logf("resp: %d (type: %s)", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+			return resp, err
+		}
+		delay := e.Retry.delay(n, resp)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if e.Debug {
+			logf("retry %d/%d: %s %s in %s (%s)", n, attempts-1, method, url, delay.Round(time.Millisecond), reason)
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt sends a single request, bounded by the endpoint
+// timeout. The timeout also covers reading the body.
+func (e *Endpoint) attempt(ctx context.Context, method, url, body string) (*response, error) {
+	if e.Timeout <= 0 {
+		return e.scraper().do(ctx, e, method, url, body)
+	}
+	timeout := time.Duration(e.Timeout)
+	actx, cancel := context.WithTimeout(ctx, timeout)
+	resp, err := e.scraper().do(actx, e, method, url, body)
+	if err != nil {
+		cancel()
+		if ctx.Err() == nil && errors.Is(actx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("upstream timeout after %s: %w", timeout, context.DeadlineExceeded)
+		}
+		return nil, err
+	}
+	resp.Body = &closeBody{ReadCloser: resp.Body, onClose: cancel}
+	return resp, nil
+}
+
+// permanentError is a request error which retrying cannot fix,
+// such as an unsupported method or a client which failed to build
+type permanentError struct {
+	err error
+}
+
+// permanent marks err as not retryable
+func permanent(err error) error {
+	return &permanentError{err}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// closeBody calls onClose once closed, for
+// example to cancel its request context
+type closeBody struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (b *closeBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.onClose()
+	return err
+}
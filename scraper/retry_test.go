@@ -0,0 +1,197 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`<h1>ok</h1>`))
+	}))
+	defer s.Close()
+	e := &Endpoint{
+		URL:    s.URL,
+		Result: map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+		Retry:  &Retry{Attempts: 3, Backoff: Duration(time.Millisecond)},
+	}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits != 3 {
+		t.Fatalf("expected 3 requests, got %d", hits)
+	}
+	if len(res) != 1 || res[0]["title"] != "ok" {
+		t.Fatalf("unexpected results: %v", res)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer s.Close()
+	e := &Endpoint{Retry: &Retry{Attempts: 3, Backoff: Duration(time.Millisecond)}}
+	resp, err := e.do(context.Background(), http.MethodGet, s.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits != 1 || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a single 404, got %d requests (status %d)", hits, resp.StatusCode)
+	}
+}
+
+func TestRetryMethods(t *testing.T) {
+	var hits int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer s.Close()
+	for _, tt := range []struct {
+		methods []string
+		want    int32
+	}{
+		// the server may have processed the request
+		{nil, 1},
+		{[]string{"post"}, 3},
+	} {
+		hits = 0
+		e := &Endpoint{Retry: &Retry{Attempts: 3, Backoff: Duration(time.Millisecond), Methods: tt.methods}}
+		resp, err := e.do(context.Background(), http.MethodPost, s.URL, "a=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if hits != tt.want {
+			t.Errorf("%v: expected %d requests, got %d", tt.methods, tt.want, hits)
+		}
+	}
+	// errors which retrying cannot fix are returned at once
+	e := &Endpoint{Retry: &Retry{Attempts: 3, Backoff: Duration(time.Hour), Methods: []string{"FOO"}}}
+	if _, err := e.do(context.Background(), "FOO", s.URL, ""); err == nil {
+		t.Fatal("expected an unsupported method error")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := &Retry{Backoff: Duration(100 * time.Millisecond), MaxBackoff: Duration(time.Second)}
+	for n, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		6: time.Second,
+	} {
+		if d := r.delay(n, nil); d < want/2 || d > want {
+			t.Errorf("delay(%d) = %s, want between %s and %s", n, d, want/2, want)
+		}
+	}
+	resp := &response{Header: http.Header{"Retry-After": {"120"}}}
+	if d := r.delay(1, resp); d != time.Second {
+		t.Errorf("expected Retry-After to be capped at 1s, got %s", d)
+	}
+	resp.Header.Set("Retry-After", "0")
+	if d := r.delay(1, resp); d != 0 {
+		t.Errorf("expected Retry-After 0, got %s", d)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d, ok := retryAfter("5"); !ok || d != 5*time.Second {
+		t.Errorf("got %s %v", d, ok)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d, ok := retryAfter(date); !ok || d < 59*time.Minute {
+		t.Errorf("got %s %v", d, ok)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Error("expected invalid Retry-After")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer s.Close()
+	defer close(done)
+	e := &Endpoint{
+		URL:     s.URL,
+		Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+		Timeout: Duration(50 * time.Millisecond),
+	}
+	start := time.Now()
+	_, err := e.Execute(nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("timeout not applied")
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	e := Endpoint{}
+	if err := json.Unmarshal([]byte(`{"timeout":"1m30s","retry":{"attempts":2,"backoff":"250ms"}}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Timeout != Duration(90*time.Second) || e.Retry.Backoff != Duration(250*time.Millisecond) {
+		t.Fatalf("unexpected durations: %v %v", e.Timeout, e.Retry.Backoff)
+	}
+	b, err := json.Marshal(e.Timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `"1m30s"` {
+		t.Fatalf("got %s", b)
+	}
+	if err := json.Unmarshal([]byte(`{"timeout":10}`), &e); err == nil {
+		t.Fatal("expected error for numeric duration")
+	}
+}
+
+func TestHandlerRetryDefaults(t *testing.T) {
+	h := &Handler{Timeout: 5 * time.Second, Attempts: 3}
+	err := h.LoadConfig([]byte(`{
+		"/a": {"url": "http://example.com", "result": {"x": "h1"}},
+		"/b": {"url": "http://example.com", "result": {"x": "h1"}, "timeout": "1s", "retry": {"attempts": 2}},
+		"/c": {"url": "http://example.com", "result": {"x": "h1"}, "retry": {"backoff": "1s"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := h.Endpoint("c").Retry; c.attempts() != 3 || c.Backoff != Duration(time.Second) {
+		t.Errorf("expected handler attempts with endpoint backoff, got %+v", c)
+	}
+	a, b := h.Endpoint("a"), h.Endpoint("b")
+	if a.Timeout != Duration(5*time.Second) || a.Retry.attempts() != 3 {
+		t.Errorf("expected handler defaults, got %v %v", a.Timeout, a.Retry)
+	}
+	if b.Timeout != Duration(time.Second) || b.Retry.attempts() != 2 {
+		t.Errorf("expected endpoint settings, got %v %v", b.Timeout, b.Retry)
+	}
+	// without handler attempts, a retry block must set its own
+	h = &Handler{Attempts: 1}
+	if err := h.LoadConfig([]byte(`{"/c": {"url": "http://example.com", "result": {"x": "h1"}, "retry": {"backoff": "1ms"}}}`)); err == nil {
+		t.Fatal("expected a retry block without attempts to be rejected")
+	}
+}
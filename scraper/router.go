@@ -0,0 +1,160 @@
+package scraper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// segment kinds, ordered by match precedence
+const (
+	segStatic = iota
+	segParam
+	segWildcard
+)
+
+type segment struct {
+	kind int
+	val  string // literal text or variable name
+}
+
+// route is a compiled endpoint path. Paths are split on "/" into
+// static segments, ":name" segments which bind a single path
+// segment, and an optional trailing "*name" which binds the rest.
+type route struct {
+	path     string
+	segments []segment
+	endpoint *Endpoint
+}
+
+func newRoute(path string, e *Endpoint) (*route, error) {
+	r := &route{path: path, endpoint: e}
+	seen := map[string]bool{}
+	parts := splitPath(path)
+	for i, p := range parts {
+		s := segment{kind: segStatic, val: p}
+		switch {
+		case strings.HasPrefix(p, ":"):
+			s = segment{kind: segParam, val: p[1:]}
+		case strings.HasPrefix(p, "*"):
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("endpoint /%s: wildcard %s must be the last segment", path, p)
+			}
+			s = segment{kind: segWildcard, val: p[1:]}
+		}
+		if s.kind != segStatic {
+			if s.val == "" {
+				return nil, fmt.Errorf("endpoint /%s: missing variable name in %q", path, p)
+			}
+			if seen[s.val] {
+				return nil, fmt.Errorf("endpoint /%s: duplicate variable %q", path, s.val)
+			}
+			seen[s.val] = true
+		}
+		r.segments = append(r.segments, s)
+	}
+	return r, nil
+}
+
+// match returns the path variables bound by this route,
+// or ok=false if the given path does not match
+func (r *route) match(parts []string) (vars map[string]string, ok bool) {
+	vars = map[string]string{}
+	for i, s := range r.segments {
+		if s.kind == segWildcard {
+			vars[s.val] = strings.Join(parts[i:], "/")
+			return vars, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch s.kind {
+		case segStatic:
+			if parts[i] != s.val {
+				return nil, false
+			}
+		case segParam:
+			vars[s.val] = parts[i]
+		}
+	}
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return vars, true
+}
+
+// shape is the route path without its variable names. Routes of
+// the same shape match the same paths, so one would shadow the other.
+func (r *route) shape() string {
+	parts := make([]string, len(r.segments))
+	for i, s := range r.segments {
+		switch s.kind {
+		case segStatic:
+			parts[i] = s.val
+		case segParam:
+			parts[i] = ":"
+		case segWildcard:
+			parts[i] = "*"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// before reports whether r should be tried before o. Segments are
+// compared left to right: static beats :param beats *wildcard, and
+// when one route is a prefix of the other the longer one wins.
+func (r *route) before(o *route) bool {
+	for i := 0; i < len(r.segments) && i < len(o.segments); i++ {
+		if a, b := r.segments[i].kind, o.segments[i].kind; a != b {
+			return a < b
+		}
+	}
+	if len(r.segments) != len(o.segments) {
+		return len(r.segments) > len(o.segments)
+	}
+	return r.path < o.path
+}
+
+// routes is a precedence-ordered list of endpoint routes
+type routes []*route
+
+func newRoutes(c Config) (routes, error) {
+	rs := make(routes, 0, len(c))
+	for path, e := range c {
+		r, err := newRoute(path, e)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].before(rs[j])
+	})
+	shapes := map[string]string{}
+	for _, r := range rs {
+		if other, ok := shapes[r.shape()]; ok {
+			return nil, fmt.Errorf("endpoints /%s and /%s match the same paths", other, r.path)
+		}
+		shapes[r.shape()] = r.path
+	}
+	return rs, nil
+}
+
+// match finds the first route matching path
+func (rs routes) match(path string) (*route, map[string]string) {
+	parts := splitPath(path)
+	for _, r := range rs {
+		if vars, ok := r.match(parts); ok {
+			return r, vars
+		}
+	}
+	return nil, nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,102 @@
+package scraper
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoutesMatch(t *testing.T) {
+	c := Config{
+		"search":            {Name: "search"},
+		"user/:id":          {Name: "user"},
+		"user/me":           {Name: "me"},
+		"user/:id/posts":    {Name: "posts"},
+		"files/*path":       {Name: "files"},
+		"files/readme":      {Name: "readme"},
+		"repo/:owner/:name": {Name: "repo"},
+	}
+	rs, err := newRoutes(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+		vars map[string]string
+	}{
+		{"search", "search", map[string]string{}},
+		{"/search/", "search", map[string]string{}},
+		{"user/42", "user", map[string]string{"id": "42"}},
+		{"user/me", "me", map[string]string{}},
+		{"user/42/posts", "posts", map[string]string{"id": "42"}},
+		{"files/readme", "readme", map[string]string{}},
+		{"files/a/b/c", "files", map[string]string{"path": "a/b/c"}},
+		{"files", "files", map[string]string{"path": ""}},
+		{"repo/jpillora/scraper", "repo", map[string]string{"owner": "jpillora", "name": "scraper"}},
+		{"repo/jpillora", "", nil},
+		{"user/42/likes", "", nil},
+		{"missing", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r, vars := rs.match(tt.path)
+			if tt.want == "" {
+				if r != nil {
+					t.Fatalf("want no match, got %s", r.path)
+				}
+				return
+			}
+			if r == nil {
+				t.Fatalf("want %s, got no match", tt.want)
+			}
+			if r.endpoint.Name != tt.want {
+				t.Errorf("matched %s, want %s", r.endpoint.Name, tt.want)
+			}
+			if !reflect.DeepEqual(vars, tt.vars) {
+				t.Errorf("vars = %v, want %v", vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestNewRouteErrors(t *testing.T) {
+	for path, want := range map[string]string{
+		"a/*rest/b": "must be the last segment",
+		"a/:":       "missing variable name",
+		"a/*":       "missing variable name",
+		"a/:x/:x":   "duplicate variable",
+	} {
+		_, err := newRoute(path, &Endpoint{})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: want error containing %q, got %v", path, want, err)
+		}
+	}
+}
+
+func TestLoadConfigRoutes(t *testing.T) {
+	h := &Handler{}
+	err := h.LoadConfig([]byte(`{
+		"/user/:id": {"url": "https://example.com/u/{{id}}", "result": {"name": "h1"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, vars := h.routes.match("user/7")
+	if r == nil || r.path != "user/:id" || vars["id"] != "7" {
+		t.Fatalf("got %v %v", r, vars)
+	}
+	if err := h.LoadConfig([]byte(`{"/a/*x/b": {"url": "x", "result": {}}}`)); err == nil {
+		t.Fatal("expected invalid route error")
+	}
+	// routes of the same shape would shadow each other
+	for _, paths := range [][2]string{{"u/:id", "u/:name"}, {"f/*a", "f/*b"}, {"x", "x/"}} {
+		err := h.LoadConfig([]byte(`{
+			"/` + paths[0] + `": {"url": "https://example.com", "result": {"name": "h1"}},
+			"/` + paths[1] + `": {"url": "https://example.com", "result": {"name": "h1"}}
+		}`))
+		if err == nil || !strings.Contains(err.Error(), "match the same paths") {
+			t.Errorf("%v: expected a conflict error, got %v", paths, err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/enetx/g"
+	"github.com/enetx/surf"
+)
+
+// Scraper sends upstream requests on behalf of endpoints. It owns
+// the HTTP client, so separate Scrapers may use separate transports,
+// cookie jars or proxies. The zero value is ready to use.
+type Scraper struct {
+	// Client is the surf client used to send requests.
+	// It defaults to surf.NewClient(). Endpoints with a
+	// session, a proxy or a browser profile use clients
+	// of their own.
+	Client *surf.Client
+	// Transport, when set, sends requests through a standard library
+	// RoundTripper instead of surf. Useful for httptest servers,
+	// recording transports and corporate proxies.
+	Transport http.RoundTripper
+	// Cache, when set, replays upstream responses from disk
+	// instead of sending the same request again.
+	Cache      *DiskCache
+	once       sync.Once
+	hostsMu    sync.Mutex
+	hosts      map[string]*hostLimiter
+	sessionsMu sync.Mutex
+	sessions   map[string]*session
+	proxiesMu  sync.Mutex
+	proxies    map[string]*proxyPool
+	clients    map[string]*surf.Client
+	transports map[string]http.RoundTripper
+}
+
+// DefaultScraper is used by endpoints without a Scraper
+var DefaultScraper = &Scraper{}
+
+// Execute builds an Endpoint from the given struct and
+// executes it with this Scraper. See Execute.
+func (s *Scraper) Execute(gostruct interface{}) error {
+	return s.ExecuteContext(context.Background(), gostruct)
+}
+
+// ExecuteContext builds an Endpoint from the given struct and
+// executes it with this Scraper. See ExecuteContext.
+func (s *Scraper) ExecuteContext(ctx context.Context, gostruct interface{}) error {
+	return executeStruct(ctx, s, gostruct)
+}
+
+// response is an upstream response, independent
+// of the client which performed the request
+type response struct {
+	StatusCode int
+	Header     http.Header
+	URL        *url.URL
+	Body       io.ReadCloser
+}
+
+// do sends a single request on behalf of the endpoint,
+// or replays it from the cache
+func (s *Scraper) do(ctx context.Context, e *Endpoint, method, url, body string) (*response, error) {
+	if s.Cache == nil || e.Session != nil {
+		// session responses depend on their cookies
+		return s.limit(ctx, e, method, url, body)
+	}
+	key := requestHash(method, url, body, e.Headers)
+	if resp, ok := s.Cache.get(key); ok {
+		return resp, nil
+	}
+	resp, err := s.limit(ctx, e, method, url, body)
+	if err != nil || !cacheable(resp.StatusCode) {
+		return resp, err
+	}
+	return s.Cache.set(key, resp)
+}
+
+// limit sends a single request once the endpoint's limit allows it.
+// The request is in flight until its body is closed.
+func (s *Scraper) limit(ctx context.Context, e *Endpoint, method, url, body string) (*response, error) {
+	if !e.Limit.enabled() {
+		return s.send(ctx, e, method, url, body)
+	}
+	release, err := s.wait(ctx, e, url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(ctx, e, method, url, body)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &closeBody{ReadCloser: resp.Body, onClose: release}
+	return resp, nil
+}
+
+// send sends a single request, within the endpoint's session
+func (s *Scraper) send(ctx context.Context, e *Endpoint, method, url, body string) (*response, error) {
+	sess, err := s.session(e)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	proxy, done := s.proxy(e, url)
+	resp, err := s.sendProxy(ctx, e, sess, proxy, method, url, body)
+	// failed proxies are ejected, unless the request was canceled
+	if ctx.Err() == nil {
+		done(err == nil)
+	}
+	return resp, err
+}
+
+// sendProxy sends a single request with the endpoint's
+// browser, through the proxy when set
+func (s *Scraper) sendProxy(ctx context.Context, e *Endpoint, sess *session, proxy, method, url, body string) (*response, error) {
+	headers, ua := e.Browser.userAgent(e.Headers)
+	if ua != "" && e.Debug {
+		logf("user agent %s", ua)
+	}
+	if s.Transport != nil {
+		return s.doTransport(ctx, sess, proxy, method, url, body, headers)
+	}
+	client, err := s.surfClient(sess, e.Browser, proxy)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	req, err := newRequest(client, method, url)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	req = req.WithContext(ctx)
+	if body != "" {
+		req = req.Body(body)
+	}
+	if len(headers) > 0 {
+		hs := make([]any, 0, len(headers)*2)
+		for k, v := range headers {
+			hs = append(hs, k, v)
+		}
+		req = req.AddHeaders(hs...)
+	}
+	result := req.Do()
+	if result.IsErr() {
+		return nil, result.Err()
+	}
+	resp := result.Ok()
+	r := &response{
+		StatusCode: int(resp.StatusCode),
+		Header:     http.Header(resp.Headers),
+		URL:        resp.URL,
+		Body:       http.NoBody,
+	}
+	if resp.Body != nil {
+		r.Body = resp.Body.Reader
+	}
+	return r, nil
+}
+
+// doTransport sends a single request using the standard library
+func (s *Scraper) doTransport(ctx context.Context, sess *session, proxy, method, url, body string, headers map[string]string) (*response, error) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rt, err := s.proxyTransport(proxy)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	c := &http.Client{Transport: rt}
+	if sess != nil {
+		c.Jar = sess.jar
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return &response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		URL:        resp.Request.URL,
+		Body:       resp.Body,
+	}, nil
+}
+
+// client returns the surf client, creating a default one when unset
+func (s *Scraper) client() *surf.Client {
+	s.once.Do(func() {
+		if s.Client == nil {
+			s.Client = surf.NewClient()
+		}
+	})
+	return s.Client
+}
+
+// surfClient returns the surf client for the session, browser and
+// proxy. Clients are built once for each combination, and reused.
+func (s *Scraper) surfClient(sess *session, b *Browser, proxy string) (*surf.Client, error) {
+	key := b.profile() + " " + proxy
+	if sess != nil {
+		return sess.surfClient(key, b, proxy)
+	}
+	if b.profile() == "" && proxy == "" {
+		return s.client(), nil
+	}
+	s.proxiesMu.Lock()
+	defer s.proxiesMu.Unlock()
+	if c, ok := s.clients[key]; ok {
+		return c, nil
+	}
+	c, err := newSurfClient(b, proxy)
+	if err != nil {
+		return nil, err
+	}
+	if s.clients == nil {
+		s.clients = map[string]*surf.Client{}
+	}
+	s.clients[key] = c
+	return c, nil
+}
+
+// newRequest builds a surf request for the given method. surf no longer
+// exposes a generic dispatch — each verb has its own builder method.
+func newRequest(client *surf.Client, method, url string) (*surf.Request, error) {
+	u := g.String(url)
+	switch method {
+	case http.MethodGet:
+		return client.Get(u), nil
+	case http.MethodPost:
+		return client.Post(u), nil
+	case http.MethodPut:
+		return client.Put(u), nil
+	case http.MethodPatch:
+		return client.Patch(u), nil
+	case http.MethodDelete:
+		return client.Delete(u), nil
+	case http.MethodHead:
+		return client.Head(u), nil
+	}
+	return nil, fmt.Errorf("unsupported HTTP method %q", method)
+}
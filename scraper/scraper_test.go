@@ -0,0 +1,95 @@
+package scraper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder is a RoundTripper which records requests and
+// responds with a fixed body
+type recorder struct {
+	mu   sync.Mutex
+	reqs []*http.Request
+	body string
+}
+
+func (rt *recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.reqs = append(rt.reqs, r)
+	rt.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(strings.NewReader(rt.body)),
+		Request:    r,
+	}, nil
+}
+
+func TestScraperTransport(t *testing.T) {
+	rt := &recorder{body: `<h1>Hello</h1>`}
+	e := &Endpoint{
+		Method:  "POST",
+		URL:     "https://example.invalid/search?q={{q}}",
+		Body:    "q={{q}}",
+		Headers: map[string]string{"X-Test": "1"},
+		Result:  map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+		Scraper: &Scraper{Transport: rt},
+	}
+	res, err := e.Execute(map[string]string{"q": "a b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["title"] != "Hello" {
+		t.Fatalf("got %v", res)
+	}
+	if len(rt.reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(rt.reqs))
+	}
+	r := rt.reqs[0]
+	if r.Method != "POST" || r.URL.String() != "https://example.invalid/search?q=a+b" || r.Header.Get("X-Test") != "1" {
+		t.Errorf("got %s %s %v", r.Method, r.URL, r.Header)
+	}
+	if b, _ := io.ReadAll(r.Body); string(b) != "q=a b" {
+		t.Errorf("got body %q", b)
+	}
+}
+
+func TestScraperExecuteStruct(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<h1>Hello</h1>`)
+	}))
+	defer ts.Close()
+	type result struct {
+		Title string `scraper:"h1"`
+	}
+	type endpoint struct {
+		URL    string
+		Result result
+	}
+	for _, s := range []*Scraper{{}, {Transport: http.DefaultTransport}} {
+		e := endpoint{URL: ts.URL}
+		if err := s.Execute(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Result.Title != "Hello" {
+			t.Errorf("got %+v", e.Result)
+		}
+	}
+}
+
+func TestHandlerScraper(t *testing.T) {
+	rt := &recorder{body: `<h1>Hello</h1>`}
+	h := &Handler{Scraper: &Scraper{Transport: rt}}
+	if err := h.LoadConfig([]byte(`{"/a": {"url": "https://example.invalid/", "result": {"title": "h1"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/a", nil))
+	if !strings.Contains(w.Body.String(), `"title": "Hello"`) || len(rt.reqs) != 1 {
+		t.Errorf("got %d %s", len(rt.reqs), w.Body)
+	}
+}
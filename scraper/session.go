@@ -0,0 +1,296 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ehttp "github.com/enetx/http"
+	"github.com/enetx/surf"
+)
+
+// Session keeps cookies across the requests of an endpoint. Endpoints
+// with the same session Name share their cookies. In JSON, a session
+// may also be written as true (a session of its own) or as its name.
+type Session struct {
+	// Name identifies a session shared by several endpoints
+	Name string `json:"name,omitempty"`
+	// Cookies are set before the first request, for the endpoint's host
+	Cookies map[string]string `json:"cookies,omitempty"`
+	// File, when set, persists the session's cookies between restarts
+	File string `json:"file,omitempty"`
+}
+
+func (s *Session) UnmarshalJSON(b []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(b, &enabled); err == nil {
+		if !enabled {
+			return errors.New("session: expected true, a name or an object")
+		}
+		*s = Session{}
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*s = Session{Name: name}
+		return nil
+	}
+	type session Session
+	if err := json.Unmarshal(b, (*session)(s)); err != nil {
+		return fmt.Errorf("session: %w", err)
+	}
+	return nil
+}
+
+// session is the state of a Session, shared
+// by the endpoints using the same name
+type session struct {
+	mu      sync.Mutex
+	jar     *cookieJar
+	clients map[string]*surf.Client
+	// seeded holds the seeded value of each host's cookie
+	seeded map[string]string
+	// loginMu serialises the before steps of the session,
+	// and guards the login of its endpoints
+	loginMu sync.Mutex
+}
+
+// session returns the session state of the endpoint, or nil
+// when the endpoint has no session. Unnamed sessions belong
+// to a single endpoint (and its before steps).
+func (s *Scraper) session(e *Endpoint) (*session, error) {
+	if e.Session == nil {
+		return nil, nil
+	}
+	key := "name:" + e.Session.Name
+	if e.Session.Name == "" {
+		key = fmt.Sprintf("session:%p", e.Session)
+	}
+	s.sessionsMu.Lock()
+	if s.sessions == nil {
+		s.sessions = map[string]*session{}
+	}
+	sess, ok := s.sessions[key]
+	if !ok {
+		jar, err := newCookieJar(e.Session.File)
+		if err != nil {
+			s.sessionsMu.Unlock()
+			return nil, err
+		}
+		sess = &session{jar: jar, seeded: map[string]string{}}
+		s.sessions[key] = sess
+	}
+	s.sessionsMu.Unlock()
+	if err := sess.seed(e); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// seed sets the endpoint's session cookies, once for each
+// configured value, so a reloaded seed replaces the old one
+func (sess *session) seed(e *Endpoint) error {
+	if len(e.Session.Cookies) == 0 {
+		return nil
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("session: cannot seed cookies for url %q", e.URL)
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	var cookies []*http.Cookie
+	for name, value := range e.Session.Cookies {
+		key := u.Host + " " + name
+		if seeded, ok := sess.seeded[key]; !ok || seeded != value {
+			sess.seeded[key] = value
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+		}
+	}
+	if len(cookies) > 0 {
+		sess.jar.SetCookies(&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}, cookies)
+	}
+	return nil
+}
+
+// surfClient returns a surf client using the session's cookie
+// jar, one for each browser profile and proxy (see Scraper.surfClient)
+func (sess *session) surfClient(key string, b *Browser, proxy string) (*surf.Client, error) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if c, ok := sess.clients[key]; ok {
+		return c, nil
+	}
+	c, err := newSurfClient(b, proxy)
+	if err != nil {
+		return nil, err
+	}
+	c.GetClient().Jar = surfJar{sess.jar}
+	if sess.clients == nil {
+		sess.clients = map[string]*surf.Client{}
+	}
+	sess.clients[key] = c
+	return c, nil
+}
+
+// cookieJar is a cookie jar which may persist its cookies to a file
+type cookieJar struct {
+	*cookiejar.Jar
+	file    string
+	mu      sync.Mutex
+	cookies map[string]savedCookie
+}
+
+// savedCookie is a persisted cookie, along with the URL which set it
+type savedCookie struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitzero"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"httpOnly,omitempty"`
+}
+
+func (c savedCookie) key() string {
+	return c.Domain + " " + c.Path + " " + c.Name
+}
+
+// newCookieJar returns a jar, loading the cookies in file if set
+func newCookieJar(file string) (*cookieJar, error) {
+	jar, _ := cookiejar.New(nil)
+	c := &cookieJar{Jar: jar, file: file, cookies: map[string]savedCookie{}}
+	if file == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	saved := []savedCookie{}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("session file %s: %w", file, err)
+	}
+	for _, s := range saved {
+		u, err := url.Parse(s.URL)
+		if err != nil || (!s.Expires.IsZero() && s.Expires.Before(time.Now())) {
+			continue
+		}
+		c.cookies[s.key()] = s
+		jar.SetCookies(u, []*http.Cookie{{
+			Name:     s.Name,
+			Value:    s.Value,
+			Domain:   s.Domain,
+			Path:     s.Path,
+			Expires:  s.Expires,
+			Secure:   s.Secure,
+			HttpOnly: s.HttpOnly,
+		}})
+	}
+	return c, nil
+}
+
+// SetCookies stores the cookies, saving them to file if set
+func (c *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	c.Jar.SetCookies(u, cookies)
+	if c.file == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ck := range cookies {
+		s := savedCookie{
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Name:     ck.Name,
+			Value:    ck.Value,
+			Domain:   ck.Domain,
+			Path:     ck.Path,
+			Expires:  ck.Expires,
+			Secure:   ck.Secure,
+			HttpOnly: ck.HttpOnly,
+		}
+		if s.Domain == "" {
+			s.Domain = u.Hostname()
+		}
+		if ck.MaxAge > 0 {
+			s.Expires = time.Now().Add(time.Duration(ck.MaxAge) * time.Second)
+		}
+		if ck.MaxAge < 0 || (!s.Expires.IsZero() && s.Expires.Before(time.Now())) {
+			delete(c.cookies, s.key())
+		} else {
+			c.cookies[s.key()] = s
+		}
+	}
+	if err := c.save(); err != nil {
+		logf("session file %s: %s", c.file, err)
+	}
+}
+
+// save writes the cookies to file. It expects the lock to be held.
+func (c *cookieJar) save() error {
+	saved := make([]savedCookie, 0, len(c.cookies))
+	for _, s := range c.cookies {
+		saved = append(saved, s)
+	}
+	b, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), ".session-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// surfJar adapts a cookieJar to surf's http package
+type surfJar struct {
+	jar *cookieJar
+}
+
+func (j surfJar) SetCookies(u *url.URL, cookies []*ehttp.Cookie) {
+	cs := make([]*http.Cookie, len(cookies))
+	for i, c := range cookies {
+		cs[i] = &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			Expires:  c.Expires,
+			MaxAge:   c.MaxAge,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			SameSite: http.SameSite(c.SameSite),
+		}
+	}
+	j.jar.SetCookies(u, cs)
+}
+
+func (j surfJar) Cookies(u *url.URL) []*ehttp.Cookie {
+	cs := j.jar.Cookies(u)
+	cookies := make([]*ehttp.Cookie, len(cs))
+	for i, c := range cs {
+		cookies[i] = &ehttp.Cookie{Name: c.Name, Value: c.Value}
+	}
+	return cookies
+}
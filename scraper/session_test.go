@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sessionServer sets a cookie while redirecting from /login,
+// and echoes the cookies it receives on any other path
+func sessionServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/", MaxAge: 3600})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		names := []string{}
+		for _, c := range r.Cookies() {
+			names = append(names, c.Name+"="+c.Value)
+		}
+		w.Write([]byte(`<h1>` + strings.Join(names, ";") + `</h1>`))
+	}))
+}
+
+func TestSession(t *testing.T) {
+	ts := sessionServer()
+	defer ts.Close()
+	for _, s := range []*Scraper{{}, {Transport: http.DefaultTransport}} {
+		login := &Endpoint{
+			URL:     ts.URL + "/login",
+			Result:  map[string]Field{"cookies": {Extract: mustExtractors(t, "h1")}},
+			Session: &Session{Name: "shop"},
+			Scraper: s,
+		}
+		page := &Endpoint{
+			URL:     ts.URL + "/page",
+			Result:  map[string]Field{"cookies": {Extract: mustExtractors(t, "h1")}},
+			Session: &Session{Name: "shop", Cookies: map[string]string{"consent": "yes"}},
+			Scraper: s,
+		}
+		other := &Endpoint{
+			URL:     ts.URL + "/page",
+			Result:  map[string]Field{"cookies": {Extract: mustExtractors(t, "h1")}},
+			Scraper: s,
+		}
+		// the cookie set during the redirect is kept
+		res, err := login.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res[0]["cookies"] != "sid=abc" {
+			t.Fatalf("expected login cookie, got %v", res)
+		}
+		// shared by the named session, along with seeded cookies
+		res, err = page.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := res[0]["cookies"].(string); !strings.Contains(c, "sid=abc") || !strings.Contains(c, "consent=yes") {
+			t.Fatalf("expected session cookies, got %v", c)
+		}
+		// endpoints without a session have no cookies
+		res, err = other.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := res[0]["cookies"]; ok {
+			t.Fatalf("expected no cookies, got %v", res)
+		}
+	}
+}
+
+func TestSessionSeedReload(t *testing.T) {
+	ts := sessionServer()
+	defer ts.Close()
+	s := &Scraper{}
+	for _, consent := range []string{"yes", "no"} {
+		// a reloaded endpoint of the same session
+		e := &Endpoint{
+			URL:     ts.URL + "/page",
+			Result:  map[string]Field{"cookies": {Extract: mustExtractors(t, "h1")}},
+			Session: &Session{Name: "shop", Cookies: map[string]string{"consent": consent}},
+			Scraper: s,
+		}
+		res, err := e.Execute(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res[0]["cookies"] != "consent="+consent {
+			t.Fatalf("expected the seeded cookie consent=%s, got %v", consent, res)
+		}
+	}
+}
+
+func TestSessionFile(t *testing.T) {
+	ts := sessionServer()
+	defer ts.Close()
+	file := filepath.Join(t.TempDir(), "cookies.json")
+	e := &Endpoint{
+		URL:     ts.URL + "/login",
+		Result:  map[string]Field{"cookies": {Extract: mustExtractors(t, "h1")}},
+		Session: &Session{File: file},
+		Scraper: &Scraper{},
+	}
+	if _, err := e.Execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"name": "sid"`) {
+		t.Fatalf("unexpected session file %s", b)
+	}
+	// a new Scraper, as if the process restarted
+	e.URL = ts.URL + "/page"
+	e.Scraper = &Scraper{}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0]["cookies"] != "sid=abc" {
+		t.Fatalf("expected persisted cookie, got %v", res)
+	}
+}
+
+func TestHandlerSessionFile(t *testing.T) {
+	dir := t.TempDir()
+	config := func(file string) []byte {
+		return []byte(`{"/a": {"url": "http://example.com", "result": {"x": "h1"}, "session": {"file": "` + file + `"}}}`)
+	}
+	// session files are disabled without a session directory
+	h := &Handler{}
+	if err := h.LoadConfig(config("cookies.json")); err == nil {
+		t.Fatal("expected an error without a session directory")
+	}
+	h.SessionDir = dir
+	for _, file := range []string{"/etc/passwd", "../cookies.json", "a/../../cookies.json"} {
+		if err := h.LoadConfig(config(file)); err == nil {
+			t.Errorf("%s: expected an error", file)
+		}
+	}
+	if err := h.LoadConfig(config("shop/cookies.json")); err != nil {
+		t.Fatal(err)
+	}
+	if f := h.Endpoint("a").Session.File; f != filepath.Join(dir, "shop", "cookies.json") {
+		t.Fatalf("expected the file within the session directory, got %s", f)
+	}
+	// the config is served back as given
+	if f := h.Config["a"].Session.File; f != "shop/cookies.json" {
+		t.Fatalf("expected the configured file, got %s", f)
+	}
+	// a file is saved by a single session, which endpoints may share
+	two := func(a, b string) error {
+		return h.LoadConfig([]byte(`{
+			"/a": {"url": "http://example.com", "result": {"x": "h1"}, "session": ` + a + `},
+			"/b": {"url": "http://example.com", "result": {"x": "h1"}, "session": ` + b + `}
+		}`))
+	}
+	if err := two(`{"file": "s.json"}`, `{"file": "./s.json"}`); err == nil {
+		t.Fatal("expected an error for two sessions saving the same file")
+	}
+	if err := two(`{"name": "x", "file": "s.json"}`, `{"name": "y", "file": "s.json"}`); err == nil {
+		t.Fatal("expected an error for two named sessions saving the same file")
+	}
+	if err := two(`{"name": "shop", "file": "s.json"}`, `{"name": "shop", "file": "s.json"}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionJSON(t *testing.T) {
+	for input, want := range map[string]Session{
+		`true`:   {},
+		`"shop"`: {Name: "shop"},
+		`{"name":"shop","cookies":{"a":"b"},"file":"f.json"}`: {Name: "shop", Cookies: map[string]string{"a": "b"}, File: "f.json"},
+	} {
+		var s Session
+		if err := json.Unmarshal([]byte(input), &s); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if s.Name != want.Name || s.File != want.File || len(s.Cookies) != len(want.Cookies) {
+			t.Errorf("%s: got %+v", input, s)
+		}
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(`false`), &s); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSnippet is the maximum number of body bytes kept in an UpstreamError
+const maxSnippet = 512
+
+// StatusRule matches a range of upstream status codes. In JSON, a rule
+// is written as an exact code (404 or "404"), a class ("2xx") or an
+// inclusive range ("200-299").
+type StatusRule struct {
+	Min, Max int
+}
+
+func (s StatusRule) match(code int) bool {
+	return code >= s.Min && code <= s.Max
+}
+
+func (s *StatusRule) UnmarshalJSON(b []byte) error {
+	var code int
+	if err := json.Unmarshal(b, &code); err == nil {
+		*s = StatusRule{code, code}
+		return s.validate()
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return fmt.Errorf("invalid status rule %s: expected a code, class or range", b)
+	}
+	rule, err := parseStatusRule(str)
+	if err != nil {
+		return err
+	}
+	*s = rule
+	return nil
+}
+
+func (s StatusRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s StatusRule) String() string {
+	switch {
+	case s.Min == s.Max:
+		return strconv.Itoa(s.Min)
+	case s.Min%100 == 0 && s.Max == s.Min+99:
+		return strconv.Itoa(s.Min/100) + "xx"
+	}
+	return strconv.Itoa(s.Min) + "-" + strconv.Itoa(s.Max)
+}
+
+func (s StatusRule) validate() error {
+	if s.Min < 100 || s.Max > 599 || s.Min > s.Max {
+		return fmt.Errorf("invalid status rule %q", s.String())
+	}
+	return nil
+}
+
+// parseStatusRule parses "404", "2xx" or "200-299"
+func parseStatusRule(str string) (StatusRule, error) {
+	str = strings.TrimSpace(str)
+	invalid := fmt.Errorf("invalid status rule %q: expected a code, class or range", str)
+	var rule StatusRule
+	if len(str) == 3 && strings.HasSuffix(str, "xx") {
+		c, err := strconv.Atoi(str[:1])
+		if err != nil {
+			return rule, invalid
+		}
+		rule = StatusRule{c * 100, c*100 + 99}
+	} else if lo, hi, ok := strings.Cut(str, "-"); ok {
+		from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil {
+			return rule, invalid
+		}
+		rule = StatusRule{from, to}
+	} else {
+		c, err := strconv.Atoi(str)
+		if err != nil {
+			return rule, invalid
+		}
+		rule = StatusRule{c, c}
+	}
+	return rule, rule.validate()
+}
+
+// StatusRules are the upstream status codes an endpoint accepts.
+// No rules accepts any 2xx status.
+type StatusRules []StatusRule
+
+func (rs StatusRules) match(code int) bool {
+	if len(rs) == 0 {
+		return code >= 200 && code <= 299
+	}
+	for _, r := range rs {
+		if r.match(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpstreamError is returned when the remote server cannot be
+// reached, times out, or responds with an unexpected status.
+type UpstreamError struct {
+	// URL is the upstream URL requested
+	URL string
+	// StatusCode is the upstream response status,
+	// or 0 when no response was received
+	StatusCode int
+	// Body is the start of the upstream response body
+	Body string
+	// Err is the transport error when no response was received
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("upstream %s: %s", e.URL, e.Err)
+	}
+	return fmt.Sprintf("upstream %s: unexpected status %d", e.URL, e.StatusCode)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the upstream request timed out
+func (e *UpstreamError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
+
+// fetch sends a request via e.do, and converts transport
+// failures and unexpected statuses into UpstreamErrors
+func (e *Endpoint) fetch(ctx context.Context, method, url, body string) (*response, error) {
+	resp, err := e.do(ctx, method, url, body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			// a configuration error, not the upstream's failure
+			return nil, perr
+		}
+		return nil, &UpstreamError{URL: url, Err: err}
+	}
+	if !e.ExpectStatus.match(resp.StatusCode) {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxSnippet))
+		for len(b) > 0 && !utf8.Valid(b) {
+			b = b[:len(b)-1]
+		}
+		if e.Debug {
+			logf("unexpected status %d from %s", resp.StatusCode, url)
+		}
+		return nil, &UpstreamError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Body:       string(b),
+		}
+	}
+	return resp, nil
+}
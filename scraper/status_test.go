@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusRules(t *testing.T) {
+	var rs StatusRules
+	if err := json.Unmarshal([]byte(`[404, "2xx", "301-302"]`), &rs); err != nil {
+		t.Fatal(err)
+	}
+	for code, want := range map[int]bool{200: true, 299: true, 302: true, 303: false, 404: true, 500: false} {
+		if rs.match(code) != want {
+			t.Errorf("match(%d) != %v", code, want)
+		}
+	}
+	b, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `["404","2xx","301-302"]` {
+		t.Errorf("got %s", b)
+	}
+	for _, input := range []string{`"abc"`, `"9xx"`, `"300-200"`, `99`, `true`} {
+		var r StatusRule
+		if err := json.Unmarshal([]byte(input), &r); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+	if !(StatusRules{}).match(204) || (StatusRules{}).match(404) {
+		t.Error("expected default 2xx rule")
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<h1>gone</h1>` + strings.Repeat("x", 1000)))
+	}))
+	defer s.Close()
+	e := &Endpoint{
+		URL:    s.URL,
+		Result: map[string]Field{"title": {Extract: mustExtractors(t, "h1")}},
+	}
+	_, err := e.Execute(nil)
+	var uerr *UpstreamError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("expected UpstreamError, got %v", err)
+	}
+	if uerr.StatusCode != 404 || len(uerr.Body) != maxSnippet || !strings.HasPrefix(uerr.Body, "<h1>gone") {
+		t.Fatalf("unexpected error %+v", uerr)
+	}
+	// accept the 404 page
+	e.ExpectStatus = StatusRules{{404, 404}}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0]["title"] != "gone" {
+		t.Fatalf("unexpected results: %v", res)
+	}
+}
+
+func TestHandlerUpstreamStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("down"))
+	}))
+	defer s.Close()
+	h := &Handler{}
+	err := h.LoadConfig([]byte(`{
+		"/down": {"url": "` + s.URL + `/down", "result": {"title": "h1"}},
+		"/slow": {"url": "` + s.URL + `/slow", "result": {"title": "h1"}, "timeout": "50ms"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]int{"/down": http.StatusBadGateway, "/slow": http.StatusGatewayTimeout} {
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: too slow", path)
+		}
+		var body struct {
+			Error    string `json:"error"`
+			Upstream struct {
+				URL    string `json:"url"`
+				Status int    `json:"status"`
+				Body   string `json:"body"`
+			} `json:"upstream"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v: %s", path, err, rec.Body)
+		}
+		if body.Error == "" || body.Upstream.URL != s.URL+path {
+			t.Errorf("%s: unexpected body %s", path, rec.Body)
+		}
+		if path == "/down" && (body.Upstream.Status != 503 || body.Upstream.Body != "down") {
+			t.Errorf("%s: unexpected upstream %+v", path, body.Upstream)
+		}
+	}
+}
+
+func TestHandlerConfigError(t *testing.T) {
+	h := &Handler{}
+	err := h.LoadConfig([]byte(`{"/bad": {"method": "FOO", "url": "http://example.invalid", "result": {"title": "h1"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// not blamed on the upstream
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/bad", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "unsupported HTTP method") {
+		t.Fatalf("expected a 500 for the unsupported method, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,363 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// maxColspan is the largest colspan browsers honour
+const maxColspan = 1000
+
+// Table configures how table mode reads HTML tables. In JSON,
+// a table may also be written as just its selector.
+type Table struct {
+	// Selector matches the tables (defaults to "table")
+	Selector string `json:"selector,omitempty"`
+	// Header reports whether the tables have header rows (defaults
+	// to true). Header rows are those in a thead, or the leading rows
+	// of th cells, or else the first row.
+	Header *bool `json:"header,omitempty"`
+	// Headers renames columns, from their header text
+	// (or 0-based index) to a field name
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (t *Table) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = Table{Selector: s}
+		return t.validate()
+	}
+	type table Table
+	if err := json.Unmarshal(b, (*table)(t)); err != nil {
+		return fmt.Errorf("table: %w", err)
+	}
+	return t.validate()
+}
+
+func (t *Table) validate() error {
+	if err := checkSelector(t.selector()); err != nil {
+		return fmt.Errorf("table: invalid selector: %s", err)
+	}
+	return nil
+}
+
+// selector returns the table selector, nil-safe
+func (t *Table) selector() string {
+	if t == nil || t.Selector == "" {
+		return "table"
+	}
+	return t.Selector
+}
+
+// header reports whether the tables have header rows, nil-safe
+func (t *Table) header() bool {
+	return t == nil || t.Header == nil || *t.Header
+}
+
+// tableCell is a cell of an expanded table row. Cells spanning
+// several columns or rows appear in each of them.
+type tableCell struct {
+	node *html.Node
+	sel  *goquery.Selection
+	text string
+	th   bool
+}
+
+// tableRow is an expanded table row
+type tableRow struct {
+	tr    *goquery.Selection
+	cells []tableCell
+}
+
+// extractTable extracts a result from each data row of the matched
+// tables, along with the (possibly relative) next page link
+func (e *Endpoint) extractTable(body io.Reader) ([]Result, string, error) {
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, "", err
+	}
+	tables := doc.Find(e.Table.selector())
+	if e.Debug {
+		logf("table: %s => #%d tables", e.Table.selector(), tables.Length())
+	}
+	results := []Result{}
+	tables.Each(func(i int, table *goquery.Selection) {
+		head, rows := tableRows(table, e.Table.header())
+		columns := e.tableColumns(head, rows)
+		for j, row := range rows {
+			if len(e.Result) == 0 {
+				r := Result{}
+				for c, cell := range row.cells {
+					r[tableColumn(columns, c)] = cell.text
+				}
+				results = append(results, r)
+				continue
+			}
+			r, complete := e.extractTableResult(e.Result, columns, row)
+			if complete {
+				results = append(results, r)
+			} else if e.Debug {
+				logf("excluded table #%d row #%d: has %d fields, expected %d", i, j, len(r), len(e.Result))
+			}
+		}
+	})
+	next := ""
+	if p := e.Paginate; p != nil && len(p.Next) > 0 {
+		next = p.Next.execute(doc.Selection)
+	}
+	return results, next, nil
+}
+
+// extractTableResult extracts result fields from a row. The first
+// extractor of each field is a column name or a (0-based) column
+// index, and the remaining extractors are applied to its cell, whose
+// text is the initial value. Nested results group columns, or with
+// a list, split the row. Reports whether every required field was
+// found.
+func (e *Endpoint) extractTableResult(fields map[string]Field, columns []string, row tableRow) (Result, bool) {
+	r := Result{}
+	complete := true
+	for field, f := range fields {
+		if f.nested() {
+			if f.List == "" {
+				r[field], _ = e.extractTableResult(f.Result, columns, row)
+			} else {
+				r[field] = e.extractNested(f, row.tr)
+			}
+			continue
+		}
+		ext := f.Extract
+		if len(f.Follow) > 0 {
+			ext = f.Follow
+		}
+		if len(ext) == 0 {
+			if e.Debug {
+				logf("field %q: table mode expects a column", field)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		c := tableColumnIndex(columns, ext[0].val)
+		if c < 0 || c >= len(row.cells) {
+			if e.Debug {
+				logf("missing %s (no column %q)", field, ext[0].val)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		v, sel := row.cells[c].text, row.cells[c].sel
+		for _, x := range ext[1:] {
+			v, sel = x.fn(v, sel)
+		}
+		if v == "" {
+			if e.Debug {
+				logf("missing %s", field)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		if len(f.Follow) > 0 {
+			r[field] = v
+		} else if cv, err := f.convert(v); err == nil {
+			r[field] = cv
+		} else if e.Debug {
+			logf("field %q: %v", field, err)
+		}
+	}
+	return r, complete
+}
+
+// tableColumns names the columns from the header rows, joining the
+// text of stacked header cells. Unnamed columns are left empty,
+// repeated names are numbered, and then columns are renamed.
+func (e *Endpoint) tableColumns(head, rows []tableRow) []string {
+	columns := []string{}
+	for _, row := range append(head[:len(head):len(head)], rows...) {
+		for len(columns) < len(row.cells) {
+			columns = append(columns, "")
+		}
+	}
+	seen := map[string]int{}
+	for c := range columns {
+		var parts []string
+		var prev *html.Node
+		for _, row := range head {
+			if c >= len(row.cells) || row.cells[c].node == prev {
+				continue
+			}
+			prev = row.cells[c].node
+			if t := row.cells[c].text; t != "" {
+				parts = append(parts, t)
+			}
+		}
+		name := strings.Join(parts, " ")
+		if name != "" {
+			if seen[name]++; seen[name] > 1 {
+				name += "_" + strconv.Itoa(seen[name])
+			}
+		}
+		columns[c] = name
+	}
+	if e.Table != nil {
+		for c, name := range columns {
+			if to, ok := e.Table.Headers[name]; ok && name != "" {
+				columns[c] = to
+			} else if to, ok := e.Table.Headers[strconv.Itoa(c)]; ok {
+				columns[c] = to
+			}
+		}
+	}
+	return columns
+}
+
+// tableColumn returns the name of column c, or its index
+// when it has none
+func tableColumn(columns []string, c int) string {
+	if c < len(columns) && columns[c] != "" {
+		return columns[c]
+	}
+	return strconv.Itoa(c)
+}
+
+// tableColumnIndex returns the index of the named (or numbered)
+// column, or -1 when there is no such column
+func tableColumnIndex(columns []string, name string) int {
+	for c, col := range columns {
+		if col == name {
+			return c
+		}
+	}
+	if c, err := strconv.Atoi(name); err == nil && c >= 0 {
+		return c
+	}
+	return -1
+}
+
+// tableRows expands the rows of a table, excluding those of nested
+// tables, into its header rows and data rows. Row spans are confined
+// to their thead, tbody or tfoot, as in browsers. (The parser wraps
+// rows outside of these in a tbody.)
+func tableRows(table *goquery.Selection, header bool) (head, rows []tableRow) {
+	var sections [][]tableRow
+	var thead []bool
+	table.ChildrenFiltered("thead, tbody, tfoot").Each(func(_ int, s *goquery.Selection) {
+		sections = append(sections, tableSection(s.ChildrenFiltered("tr")))
+		thead = append(thead, goquery.NodeName(s) == "thead")
+	})
+	for i, section := range sections {
+		if header && thead[i] {
+			head = append(head, section...)
+		} else {
+			rows = append(rows, section...)
+		}
+	}
+	if header && len(head) == 0 {
+		// leading rows of th cells, or else the first row
+		n := 0
+		for n < len(rows) && tableHeaderRow(rows[n]) {
+			n++
+		}
+		if n == 0 && len(rows) > 0 {
+			n = 1
+		}
+		head, rows = rows[:n], rows[n:]
+	}
+	return head, rows
+}
+
+// tableHeaderRow reports whether every cell of the row is a th
+func tableHeaderRow(row tableRow) bool {
+	for _, cell := range row.cells {
+		if !cell.th {
+			return false
+		}
+	}
+	return len(row.cells) > 0
+}
+
+// tableSection expands the rows of a section into a grid,
+// repeating cells in each column and row they span
+func tableSection(trs *goquery.Selection) []tableRow {
+	type span struct {
+		cell tableCell
+		rows int
+	}
+	grid := []tableRow{}
+	pending := map[int]*span{}
+	n := trs.Length()
+	trs.Each(func(i int, tr *goquery.Selection) {
+		row := tableRow{tr: tr}
+		// place a cell in the next column, holding
+		// it for the rows it spans below
+		place := func(cell tableCell, rows int) {
+			if rows > 1 {
+				pending[len(row.cells)] = &span{cell: cell, rows: rows - 1}
+			} else {
+				delete(pending, len(row.cells))
+			}
+			row.cells = append(row.cells, cell)
+		}
+		// fill columns held by cells spanning rows from above
+		fill := func() {
+			for {
+				s, ok := pending[len(row.cells)]
+				if !ok {
+					return
+				}
+				place(s.cell, s.rows)
+			}
+		}
+		tr.ChildrenFiltered("td, th").Each(func(_ int, td *goquery.Selection) {
+			fill()
+			cell := tableCell{
+				node: td.Nodes[0],
+				sel:  td,
+				text: strings.TrimSpace(td.Text()),
+				th:   goquery.NodeName(td) == "th",
+			}
+			rows := tableSpan(td, "rowspan")
+			if rows == 0 {
+				// spans the rest of the section
+				rows = n - i
+			}
+			for range min(max(tableSpan(td, "colspan"), 1), maxColspan) {
+				place(cell, rows)
+			}
+		})
+		fill()
+		// columns held from above, past the end of this row's cells
+		last := -1
+		for c := range pending {
+			last = max(last, c)
+		}
+		for len(row.cells) <= last {
+			if _, ok := pending[len(row.cells)]; ok {
+				fill()
+			} else {
+				row.cells = append(row.cells, tableCell{sel: &goquery.Selection{}})
+			}
+		}
+		grid = append(grid, row)
+	})
+	return grid
+}
+
+// tableSpan parses a colspan or rowspan attribute, defaulting to 1
+func tableSpan(td *goquery.Selection, attr string) int {
+	v, ok := td.Attr(attr)
+	if !ok {
+		return 1
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const pricesTable = `<html><body>
+<table id="prices">
+  <thead>
+    <tr><th rowspan="2">Region</th><th rowspan="2">Name</th><th colspan="2">Price</th></tr>
+    <tr><th>Min</th><th>Max</th></tr>
+  </thead>
+  <tbody>
+    <tr><td rowspan="2">EU</td><td><a href="/a">Widget</a></td><td>1</td><td>2</td></tr>
+    <tr><td>Gadget<table><tr><td>nested</td></tr></table></td><td colspan="2">3</td></tr>
+  </tbody>
+  <tbody>
+    <tr><td>US</td><td>Gizmo</td><td>4</td><td>5</td></tr>
+  </tbody>
+</table>
+</body></html>`
+
+func TestExtractTable(t *testing.T) {
+	e := &Endpoint{Mode: "table", Table: &Table{Selector: "#prices", Headers: map[string]string{"Price Min": "min"}}}
+	res, _, err := e.extractTable(strings.NewReader(pricesTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"Name":"Widget","Price Max":"2","Region":"EU","min":"1"},` +
+		`{"Name":"Gadgetnested","Price Max":"3","Region":"EU","min":"3"},` +
+		`{"Name":"Gizmo","Price Max":"5","Region":"US","min":"4"}]`
+	if b, _ := json.Marshal(res); string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+	e.Result = map[string]Field{
+		"name":   {Extract: mustExtractors(t, "Name", "/^(\\w+?)(nested)?$/")},
+		"link":   {Extract: mustExtractors(t, "1", "a", "@href")},
+		"prices": {Result: map[string]Field{"min": {Extract: mustExtractors(t, "min"), Type: typeInt}, "max": {Extract: mustExtractors(t, "3"), Type: typeInt}}},
+	}
+	res, _, err = e.extractTable(strings.NewReader(pricesTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `[{"link":"/a","name":"Widget","prices":{"max":2,"min":1}}]`
+	if b, _ := json.Marshal(res); string(b) != want {
+		t.Fatalf("expected rows without links to be excluded, %s, got %s", want, b)
+	}
+}
+
+func TestExtractTableHeaders(t *testing.T) {
+	for name, tt := range map[string]struct {
+		html  string
+		table *Table
+		want  string
+	}{
+		"th rows": {
+			`<table><tr><th>a</th><th>a</th><th></th></tr><tr><td>1</td><td>2</td><td>3</td></tr></table>`,
+			nil,
+			`[{"2":"3","a":"1","a_2":"2"}]`,
+		},
+		"first row": {
+			`<table><tr><td>a</td><td>b</td></tr><tr><td>1</td></tr></table>`,
+			&Table{Headers: map[string]string{"1": "x"}},
+			`[{"a":"1"}]`,
+		},
+		"no header": {
+			`<table><tr><td>a</td><td rowspan="0">b</td></tr><tr><td>1</td></tr><tr><td>2</td></tr></table>`,
+			&Table{Header: new(bool), Headers: map[string]string{"1": "x"}},
+			`[{"0":"a","x":"b"},{"0":"1","x":"b"},{"0":"2","x":"b"}]`,
+		},
+		"trailing rowspan": {
+			`<table><tr><th>a</th><th>b</th><th>c</th></tr><tr><td>1</td><td>2</td><td rowspan="2">3</td></tr><tr></tr></table>`,
+			nil,
+			`[{"a":"1","b":"2","c":"3"},{"a":"","b":"","c":"3"}]`,
+		},
+	} {
+		e := &Endpoint{Mode: "table", Table: tt.table}
+		res, _, err := e.extractTable(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if b, _ := json.Marshal(res); string(b) != tt.want {
+			t.Errorf("%s:\nexpected %s\n     got %s", name, tt.want, b)
+		}
+	}
+}
+
+func TestTableEndpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(pricesTable))
+	}))
+	defer ts.Close()
+	e := &Endpoint{}
+	if err := json.Unmarshal([]byte(`{"mode": "table", "url": "`+ts.URL+`", "table": "#prices", "result": {"name": "Name"}}`), e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Table.Selector != "#prices" {
+		t.Fatalf("expected the table selector, got %+v", e.Table)
+	}
+	e.Scraper = &Scraper{Transport: http.DefaultTransport}
+	res, err := e.Execute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 || res[2]["name"] != "Gizmo" {
+		t.Fatalf("unexpected results %v", res)
+	}
+}
+
+func TestTableHandlerOneRow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<table><tr><th>A</th></tr><tr><td>1</td></tr></table>`))
+	}))
+	defer ts.Close()
+	h := &Handler{}
+	if err := h.LoadConfig([]byte(`{"/t": {"mode": "table", "url": "` + ts.URL + `"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/t", nil))
+	// a table is an array, whatever its number of rows
+	var res []map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res) != 1 || res[0]["A"] != "1" {
+		t.Fatalf("expected an array of one row, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -2,12 +2,14 @@ package scraper
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -61,8 +63,46 @@ func checkSelector(s string) (err error) {
 	return
 }
 
+// Duration is a time.Duration which is written
+// in JSON as a string, for example "1m30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s: expected a string like \"10s\"", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
 func jsonerr(err error) []byte {
-	return []byte(`{"error":"` + err.Error() + `"}`)
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+	return b
+}
+
+// upstreamerr is jsonerr including the upstream failure details
+func upstreamerr(err error, u *UpstreamError) []byte {
+	type upstream struct {
+		URL    string `json:"url"`
+		Status int    `json:"status,omitempty"`
+		Body   string `json:"body,omitempty"`
+	}
+	b, _ := json.Marshal(struct {
+		Error    string   `json:"error"`
+		Upstream upstream `json:"upstream"`
+	}{err.Error(), upstream{u.URL, u.StatusCode, u.Body}})
+	return b
 }
 
 func logf(format string, args ...interface{}) {
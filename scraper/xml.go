@@ -0,0 +1,312 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// extractXML extracts results from an XML response using XPath
+// selectors, along with the (possibly relative) next page link
+func (e *Endpoint) extractXML(body io.Reader) ([]Result, string, error) {
+	doc, err := xmlquery.Parse(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse XML: %w", err)
+	}
+	items := []*xmlquery.Node{doc}
+	if e.List != "" {
+		if items, err = e.xpathNodes(doc, e.List); err != nil {
+			return nil, "", fmt.Errorf("list selector %q: %w", e.List, err)
+		}
+	}
+	if e.Debug && e.List != "" {
+		logf("list: %s => #%d elements", e.List, len(items))
+	}
+	results := make([]Result, 0, len(items))
+	for i, item := range items {
+		r, complete := e.extractXMLResult(e.Result, item)
+		if e.List == "" || complete {
+			results = append(results, r)
+		} else if e.Debug {
+			logf("excluded #%d: has %d fields, expected %d", i, len(r), len(e.Result))
+		}
+	}
+	next := ""
+	if p := e.Paginate; p != nil && len(p.Next) > 0 {
+		next = e.xpathExtract(p.Next, doc)
+	}
+	return results, next, nil
+}
+
+// extractXMLResult extracts result fields from a single node,
+// and reports whether every required field was found
+func (e *Endpoint) extractXMLResult(fields map[string]Field, node *xmlquery.Node) (Result, bool) {
+	r := Result{}
+	complete := true
+	for field, f := range fields {
+		if f.nested() {
+			if f.List == "" {
+				r[field], _ = e.extractXMLResult(f.Result, node)
+				continue
+			}
+			items, err := e.xpathNodes(node, f.List)
+			if err != nil {
+				if e.Debug {
+					logf("field %q (%s): %v", field, f.List, err)
+				}
+				continue
+			}
+			results := []Result{}
+			for _, item := range items {
+				if r, _ := e.extractXMLResult(f.Result, item); len(r) > 0 {
+					results = append(results, r)
+				}
+			}
+			r[field] = results
+			continue
+		}
+		ext := f.Extract
+		if len(f.Follow) > 0 {
+			ext = f.Follow
+		}
+		v := e.xpathExtract(ext, node)
+		if v == "" {
+			if e.Debug {
+				logf("missing %s", field)
+			}
+			complete = complete && !f.required()
+			continue
+		}
+		if len(f.Follow) > 0 {
+			r[field] = v
+		} else if cv, err := f.convert(v); err == nil {
+			r[field] = cv
+		} else if e.Debug {
+			logf("field %q: %v", field, err)
+		}
+	}
+	return r, complete
+}
+
+// xpathExtract runs an extractor pipeline against a node. XPath
+// expressions select nodes relative to the current ones, and set
+// the value to their text (comma-joined when several match) or to
+// the result of an XPath function. first(), join() and html() act
+// on the current nodes, while string extractors (regex, s///,
+// trim() and query-param()) transform the value.
+func (e *Endpoint) xpathExtract(ex Extractors, node *xmlquery.Node) string {
+	value := ""
+	nodes := []*xmlquery.Node{node}
+	for _, x := range ex {
+		switch v := x.val; {
+		case v == "first()":
+			if len(nodes) > 1 {
+				nodes = nodes[:1]
+			}
+			value = xmlText(nodes, ",")
+		case strings.HasPrefix(v, "join("):
+			// the separator was validated by the extractor
+			sep, _ := unquoteJoinSep(strings.TrimSuffix(strings.TrimPrefix(v, "join("), ")"))
+			value = xmlText(nodes, sep)
+		case v == "html()":
+			parts := make([]string, len(nodes))
+			for i, n := range nodes {
+				parts[i] = n.OutputXML(false)
+			}
+			value = strings.Join(parts, "")
+		case stringExtractor(v):
+			value, _ = x.fn(value, &goquery.Selection{})
+		default:
+			var err error
+			nodes, value, err = e.xpathEval(nodes, strings.TrimPrefix(v, "xpath:"))
+			if err != nil && e.Debug {
+				logf("xpath %q: %v", v, err)
+			}
+		}
+	}
+	return value
+}
+
+// xpathExtractor reports whether the extractor is
+// an XPath expression, as evaluated by xpathExtract
+func xpathExtractor(v string) bool {
+	return v != "first()" && !strings.HasPrefix(v, "join(") && v != "html()" && !stringExtractor(v)
+}
+
+// stringExtractor reports whether the extractor only transforms
+// the current value, rather than selecting nodes
+func stringExtractor(v string) bool {
+	if _, ok := parseSed(v); ok {
+		return true
+	}
+	return v == "trim()" ||
+		len(v) > 1 && strings.HasPrefix(v, "/") && strings.HasSuffix(v, "/") ||
+		strings.HasPrefix(v, "query-param(") && strings.HasSuffix(v, ")")
+}
+
+// xpathEval evaluates the expression against each node, returning
+// the matched nodes and their text, or the value of a scalar result
+func (e *Endpoint) xpathEval(nodes []*xmlquery.Node, expr string) ([]*xmlquery.Node, string, error) {
+	x, err := e.compiledXPath(expr)
+	if err != nil {
+		return nil, "", err
+	}
+	matched := []*xmlquery.Node{}
+	scalars := []string{}
+	for _, n := range nodes {
+		switch v := x.evaluate(xmlquery.CreateXPathNavigator(n)).(type) {
+		case *xpath.NodeIterator:
+			matched = append(matched, x.selectAll(n)...)
+		case string:
+			scalars = append(scalars, v)
+		case float64:
+			scalars = append(scalars, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			scalars = append(scalars, strconv.FormatBool(v))
+		}
+	}
+	if len(scalars) > 0 {
+		return nodes, strings.Join(scalars, ","), nil
+	}
+	return matched, xmlText(matched, ","), nil
+}
+
+// xpathNodes selects the nodes matching the expression
+func (e *Endpoint) xpathNodes(node *xmlquery.Node, expr string) ([]*xmlquery.Node, error) {
+	x, err := e.compiledXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return x.selectAll(node), nil
+}
+
+// compiledXPath returns the expression compiled on load, or
+// compiles it when the endpoint was not loaded by a Handler
+func (e *Endpoint) compiledXPath(expr string) (*xpathExpr, error) {
+	expr = strings.TrimPrefix(expr, "xpath:")
+	if x, ok := e.xpaths[expr]; ok {
+		return x, nil
+	}
+	return compileXPath(expr, e.Namespaces)
+}
+
+// xpathExprs are compiled XPath expressions, by expression
+type xpathExprs map[string]*xpathExpr
+
+// compileXPaths compiles the XPath expressions of an xml endpoint,
+// and of its xml before steps, so they are compiled once and invalid
+// ones are rejected when the endpoint is loaded. Feed fields may be
+// jq selectors of JSON Feeds instead, so invalid ones fail when used.
+func (e *Endpoint) compileXPaths() error {
+	c := &xpathCompiler{exprs: xpathExprs{}, ns: e.Namespaces, strict: true}
+	switch e.mode() {
+	case "xml":
+		if e.List != "" {
+			if err := c.add(e.List); err != nil {
+				return fmt.Errorf("list: %w", err)
+			}
+		}
+		if err := c.addFields(e.Result, true); err != nil {
+			return err
+		}
+		if e.LoggedOut != nil && e.LoggedOut.Selector != "" {
+			if err := c.add(e.LoggedOut.Selector); err != nil {
+				return fmt.Errorf("logged out selector: %w", err)
+			}
+		}
+	case "feed":
+		c.strict = false
+		c.addFields(e.Result, false)
+		c.strict = true
+	}
+	if p := e.Paginate; p != nil && (e.mode() == "xml" || e.mode() == "feed") {
+		if err := c.addExtractors(p.Next); err != nil {
+			return fmt.Errorf("paginate next: %w", err)
+		}
+	}
+	for i, s := range e.Before {
+		mode := s.Mode
+		if mode == "" {
+			mode = e.Mode
+		}
+		if mode == "xml" {
+			if err := c.addFields(s.Result, true); err != nil {
+				return fmt.Errorf("before step %d: %w", i+1, err)
+			}
+		}
+	}
+	e.xpaths = c.exprs
+	return nil
+}
+
+// xpathCompiler collects the XPath expressions of an endpoint
+type xpathCompiler struct {
+	exprs xpathExprs
+	ns    map[string]string
+	// strict reports invalid expressions, instead of skipping them
+	strict bool
+}
+
+// add compiles the expression, once
+func (c *xpathCompiler) add(expr string) error {
+	expr = strings.TrimPrefix(expr, "xpath:")
+	if _, ok := c.exprs[expr]; ok {
+		return nil
+	}
+	x, err := compileXPath(expr, c.ns)
+	if err != nil {
+		if !c.strict {
+			return nil
+		}
+		return fmt.Errorf("xpath %q: %w", expr, err)
+	}
+	c.exprs[expr] = x
+	return nil
+}
+
+// addExtractors compiles the XPath expressions of an extractor list
+func (c *xpathCompiler) addExtractors(ex Extractors) error {
+	for _, x := range ex {
+		if xpathExtractor(x.val) {
+			if err := c.add(x.val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addFields compiles the XPath expressions of the fields. The fields
+// of followed pages are XML too when followXML is set.
+func (c *xpathCompiler) addFields(fields map[string]Field, followXML bool) error {
+	for name, f := range fields {
+		err := c.addExtractors(f.Extract)
+		if err == nil {
+			err = c.addExtractors(f.Follow)
+		}
+		if err == nil && f.List != "" {
+			err = c.add(f.List)
+		}
+		if err == nil && (f.nested() || followXML) {
+			err = c.addFields(f.Result, followXML)
+		}
+		if err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// xmlText joins the text of the nodes
+func xmlText(nodes []*xmlquery.Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.InnerText()
+	}
+	return strings.Join(parts, sep)
+}
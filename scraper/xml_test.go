@@ -0,0 +1,129 @@
+package scraper
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const oaiXML = `<?xml version="1.0" encoding="UTF-8"?>
+<OAI-PMH xmlns="http://www.openarchives.org/OAI/2.0/">
+  <ListRecords>
+    <record>
+      <header><identifier>oai:1</identifier></header>
+      <metadata>
+        <oai_dc:dc xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+          <dc:title>  First  </dc:title>
+          <dc:creator>Ann</dc:creator>
+          <dc:creator>Bob</dc:creator>
+          <dc:identifier>https://example.com/item?id=1</dc:identifier>
+        </oai_dc:dc>
+      </metadata>
+    </record>
+    <record status="deleted">
+      <header><identifier>oai:2</identifier></header>
+    </record>
+    <resumptionToken cursor="0">tok2</resumptionToken>
+  </ListRecords>
+</OAI-PMH>`
+
+func TestExtractXML(t *testing.T) {
+	e := &Endpoint{
+		Mode:       "xml",
+		List:       "//record",
+		Namespaces: map[string]string{"dc": "http://purl.org/dc/elements/1.1/"},
+		Result: map[string]Field{
+			"id":       {Extract: mustExtractors(t, "header/identifier", "s/oai://")},
+			"title":    {Extract: mustExtractors(t, ".//dc:title", "trim()")},
+			"creators": {Extract: mustExtractors(t, ".//dc:creator", "join(;)")},
+			"first":    {Extract: mustExtractors(t, ".//dc:creator", "first()")},
+			"item":     {Extract: mustExtractors(t, ".//dc:identifier", "query-param(id)"), Type: typeInt},
+			"count":    {Extract: mustExtractors(t, "count(.//dc:creator)")},
+		},
+		Paginate: &Paginate{Next: mustExtractors(t, "//resumptionToken", "/tok(\\d+)/")},
+	}
+	res, next, err := e.extractXML(strings.NewReader(oaiXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected the incomplete record to be excluded, got %v", res)
+	}
+	want := `{"count":"2","creators":"Ann;Bob","first":"Ann","id":"1","item":1,"title":"First"}`
+	if b, _ := json.Marshal(res[0]); string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+	if next != "2" {
+		t.Fatalf("expected next 2, got %q", next)
+	}
+}
+
+func TestExtractXMLNested(t *testing.T) {
+	e := &Endpoint{
+		Mode: "xml",
+		Result: map[string]Field{
+			"records": {List: "//record", Result: map[string]Field{
+				"id":     {Extract: mustExtractors(t, "xpath:header/identifier")},
+				"status": {Extract: mustExtractors(t, "@status")},
+			}},
+		},
+	}
+	res, _, err := e.extractXML(strings.NewReader(oaiXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"records":[{"id":"oai:1"},{"id":"oai:2","status":"deleted"}]}]`
+	if b, _ := json.Marshal(res); string(b) != want {
+		t.Fatalf("expected %s, got %s", want, b)
+	}
+	// invalid XML and list selectors are errors
+	if _, _, err := e.extractXML(strings.NewReader(`<a><b></a>`)); err == nil {
+		t.Fatal("expected an error")
+	}
+	e.List = "//["
+	if _, _, err := e.extractXML(strings.NewReader(oaiXML)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestXMLCompile(t *testing.T) {
+	for _, config := range []string{
+		`{"mode": "xml", "list": "//record[", "result": {"id": "header"}}`,
+		`{"mode": "xml", "result": {"id": ["header", "identifier[1"]}}`,
+		`{"mode": "xml", "result": {"id": "header"}, "loggedOut": {"selector": "//form["}}`,
+		`{"mode": "xml", "result": {"id": "header"}, "paginate": {"next": "//next["}}`,
+	} {
+		h := &Handler{}
+		if err := h.LoadConfig([]byte(`{"/x": ` + config + `}`)); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+	h := &Handler{}
+	err := h.LoadConfig([]byte(`{"/x": {
+		"mode": "xml",
+		"list": "//record",
+		"namespaces": {"dc": "http://purl.org/dc/elements/1.1/"},
+		"result": {"id": ["header/identifier", "s/oai://"], "title": [".//dc:title", "trim()"]}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := h.Endpoint("x")
+	if len(e.xpaths) != 3 {
+		t.Fatalf("expected 3 compiled expressions, got %v", e.xpaths)
+	}
+	// compiled expressions are shared by concurrent requests
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _, err := e.extractXML(strings.NewReader(oaiXML))
+			if err != nil || len(res) != 1 || res[0]["title"] != "First" {
+				t.Errorf("unexpected results %v %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// xpathExpr is a compiled XPath expression which may be used
+// concurrently. Evaluating an xpath.Expr resets its state, while
+// the node iterators it returns are copies.
+type xpathExpr struct {
+	mu   sync.Mutex
+	expr *xpath.Expr
+}
+
+// compileXPath compiles expr, with the given namespace prefixes
+func compileXPath(expr string, ns map[string]string) (*xpathExpr, error) {
+	x, err := xpath.CompileWithNS(expr, ns)
+	if err != nil {
+		return nil, err
+	}
+	return &xpathExpr{expr: x}, nil
+}
+
+// evaluate returns the result of the expression at the node
+func (x *xpathExpr) evaluate(nav xpath.NodeNavigator) any {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.expr.Evaluate(nav)
+}
+
+// selectAll returns the XML nodes matching the expression
+func (x *xpathExpr) selectAll(node *xmlquery.Node) []*xmlquery.Node {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return xmlquery.QuerySelectorAll(node, x.expr)
+}
+
+// xpathSelect evaluates expr against each element of sel, for the
+// xpath: extractor. Matched elements become the new selection, and
+// set an empty value to their text, as CSS selectors do. Attribute
+// and function results set the value, leaving the selection as-is.
+func xpathSelect(expr *xpathExpr, value string, sel *goquery.Selection) (string, *goquery.Selection) {
+	var nodes []*html.Node
+	var values []string
+	for _, n := range sel.Nodes {
+		switch v := expr.evaluate(htmlquery.CreateXPathNavigator(n)).(type) {
+		case *xpath.NodeIterator:
+			for v.MoveNext() {
+				nav := v.Current().(*htmlquery.NodeNavigator)
+				if nav.NodeType() == xpath.AttributeNode {
+					values = append(values, nav.Value())
+				} else {
+					nodes = append(nodes, nav.Current())
+				}
+			}
+		case string:
+			values = append(values, v)
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		}
+	}
+	if len(values) > 0 {
+		return strings.Join(values, ","), sel
+	}
+	s := &goquery.Selection{}
+	if len(sel.Nodes) > 0 {
+		// matches may be outside of the selection, such as siblings
+		root := sel.Nodes[0]
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		s = goquery.NewDocumentFromNode(root).FindNodes(nodes...)
+	}
+	if value == "" && s.Length() > 0 {
+		strs := make([]string, s.Length())
+		s.Each(func(i int, s *goquery.Selection) {
+			strs[i] = s.Text()
+		})
+		value = strings.Join(strs, ",")
+	}
+	return value, s
+}